@@ -3,21 +3,36 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
 
+	"github.com/crcc/jsonp/debugger"
 	"github.com/crcc/jsonp/engine"
 	"github.com/crcc/jsonp/kernel"
 	"github.com/crcc/jsonp/repl"
 )
 
+var debug bool
+
+func init() {
+	flag.BoolVar(&debug, "d", false, "debug evaluation, commands are read from stdin, try help when stopped")
+}
+
 func main() {
 	flag.Parse()
 
 	interp := kernel.NewKernelInterpreter()
+	if debug {
+		d := debugger.New(engine.ParserFunc(kernel.ParseJson), os.Stdin, os.Stderr)
+		if err := d.Attach(interp); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+	}
 	loader := kernel.NewFileModuleLoader([]string{}, engine.ParserFunc(kernel.ParseJsonModule))
 	eval := kernel.NewRepl(engine.ParserFunc(kernel.ParseJson), interp, loader)
 
 	err := repl.Do(eval)
 	if err != nil {
-		fmt.Println(err.Error())
+		fmt.Printf("%+v\n", err)
 	}
 }
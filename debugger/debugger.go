@@ -0,0 +1,355 @@
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/crcc/jsonp/engine"
+	"github.com/crcc/jsonp/kernel"
+)
+
+type Exp = engine.Exp
+
+var (
+	ErrQuit              = errors.New("Debugger Quit")
+	ErrNotDebuggable     = errors.New("Interpreter Not Debuggable")
+	ErrAlreadyAttached   = errors.New("Debugger Already Attached")
+	errInvalidBreakpoint = errors.New("expect function name, line or file:line")
+)
+
+const (
+	// frames with more names are summarized by env command, like the prelude
+	maxEnvNames = 20
+	// stopped redexes are printed briefly
+	maxExpLength = 80
+)
+
+type stepMode uint8
+
+const (
+	runMode stepMode = iota
+	stepInto
+	stepOver
+	stepOut
+)
+
+// file is empty if unknown, it matches any file in a breakpoint
+type position struct {
+	file string
+	line int
+}
+
+// Debugger stops before reducing redexes at breakpoints or steps, and reads commands while stopped.
+// only redexes with source spans stop, variable references never stop.
+type Debugger struct {
+	interp engine.Interpreter
+	parser engine.Parser
+	in     *bufio.Reader
+	out    io.Writer
+
+	funcBreaks map[string]struct{}
+	lineBreaks map[position]struct{}
+
+	mode stepMode
+	// call depth and position of the stop where a step is given
+	depth   int
+	stopPos position
+	// last redex reached, functions are entered and lines are moved onto relative to it
+	lastPos   position
+	lastDepth int
+	lastTop   engine.Frame
+	// evaluating an expression for print, nothing stops
+	evaluating bool
+}
+
+// New gives a debugger reading commands from in, it stops at the first redex
+func New(parser engine.Parser, in io.Reader, out io.Writer) *Debugger {
+	return &Debugger{
+		parser:     parser,
+		in:         bufio.NewReader(in),
+		out:        out,
+		funcBreaks: make(map[string]struct{}),
+		lineBreaks: make(map[position]struct{}),
+		mode:       stepInto,
+	}
+}
+
+// Attach hooks the debugger into interp
+func (d *Debugger) Attach(interp engine.Interpreter) error {
+	di, ok := interp.(engine.DebuggableInterpreter)
+	if !ok {
+		return ErrNotDebuggable
+	}
+	if old := di.RegisterDebugHook(d); old != nil {
+		di.RegisterDebugHook(old)
+		return ErrAlreadyAttached
+	}
+	d.interp = interp
+	return nil
+}
+
+// Break adds a breakpoint of a function name, a line or file:line
+func (d *Debugger) Break(spec string) error {
+	if spec == "" {
+		return errInvalidBreakpoint
+	}
+	if pos, ok := parsePosition(spec); ok {
+		d.lineBreaks[pos] = struct{}{}
+		return nil
+	}
+	d.funcBreaks[spec] = struct{}{}
+	return nil
+}
+
+// Delete removes a breakpoint added by Break
+func (d *Debugger) Delete(spec string) error {
+	if pos, ok := parsePosition(spec); ok {
+		if _, ok := d.lineBreaks[pos]; ok {
+			delete(d.lineBreaks, pos)
+			return nil
+		}
+	} else if _, ok := d.funcBreaks[spec]; ok {
+		delete(d.funcBreaks, spec)
+		return nil
+	}
+	return fmt.Errorf("no such breakpoint: %s", spec)
+}
+
+// Continue runs until a breakpoint, instead of stopping at the first redex
+func (d *Debugger) Continue() {
+	d.mode = runMode
+}
+
+// "12" or "main.jsonp:12"
+func parsePosition(spec string) (position, bool) {
+	file := ""
+	lineStr := spec
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		file, lineStr = spec[:i], spec[i+1:]
+	}
+	line, err := strconv.Atoi(lineStr)
+	if err != nil || line <= 0 {
+		return position{}, false
+	}
+	return position{file: file, line: line}, true
+}
+
+func (d *Debugger) BeforeReduce(ctx engine.Context, exp Exp, env engine.Env) error {
+	if d.evaluating {
+		return nil
+	}
+	r, ok := exp.(engine.Redex)
+	if !ok || r.Span == nil || r.Name == "var" {
+		return nil
+	}
+
+	depth := 0
+	var top engine.Frame
+	if stack := engine.GetCallStack(ctx); stack != nil {
+		depth = stack.Len()
+		top, _ = stack.Top()
+	}
+	pos := position{file: r.Span.File, line: r.Span.Line}
+
+	// tail calls replace the top frame without growing the stack
+	entered := depth > d.lastDepth || (depth > 0 && depth == d.lastDepth && top != d.lastTop)
+	moved := pos != d.lastPos
+	d.lastPos, d.lastDepth, d.lastTop = pos, depth, top
+
+	if !d.shouldStop(depth, top, pos, entered, moved) {
+		return nil
+	}
+	return d.stop(ctx, r, env, depth, pos)
+}
+
+func (d *Debugger) shouldStop(depth int, top engine.Frame, pos position, entered, moved bool) bool {
+	switch d.mode {
+	case stepInto:
+		return true
+	case stepOver:
+		if depth <= d.depth && pos != d.stopPos {
+			return true
+		}
+	case stepOut:
+		if depth < d.depth {
+			return true
+		}
+	}
+
+	if entered && depth > 0 {
+		if _, ok := d.funcBreaks[top.Name]; ok {
+			return true
+		}
+		if _, ok := d.funcBreaks[top.String()]; ok {
+			return true
+		}
+	}
+	if moved {
+		if _, ok := d.lineBreaks[pos]; ok {
+			return true
+		}
+		if _, ok := d.lineBreaks[position{line: pos.line}]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// stop reads commands until one resumes evaluation
+func (d *Debugger) stop(ctx engine.Context, r engine.Redex, env engine.Env, depth int, pos position) error {
+	d.printStop(ctx, r)
+	for {
+		fmt.Fprint(d.out, "(debug) ")
+		line, err := d.in.ReadString('\n')
+		if err != nil && line == "" {
+			// no more commands, run to the end
+			fmt.Fprintln(d.out)
+			d.mode = runMode
+			return nil
+		}
+
+		cmd, arg := splitCommand(line)
+		switch cmd {
+		case "s", "step":
+			d.mode = stepInto
+			return nil
+		case "n", "next":
+			d.mode, d.depth, d.stopPos = stepOver, depth, pos
+			return nil
+		case "o", "out":
+			d.mode, d.depth = stepOut, depth
+			return nil
+		case "c", "continue":
+			d.mode = runMode
+			return nil
+		case "b", "break":
+			if err := d.Break(arg); err != nil {
+				fmt.Fprintf(d.out, "Error: %s\n", err.Error())
+			}
+		case "d", "delete":
+			if err := d.Delete(arg); err != nil {
+				fmt.Fprintf(d.out, "Error: %s\n", err.Error())
+			}
+		case "bt", "backtrace":
+			d.printBacktrace(ctx, r)
+		case "env":
+			d.printEnv(env)
+		case "p", "print":
+			d.print(ctx, env, arg)
+		case "q", "quit":
+			return ErrQuit
+		case "h", "help":
+			d.printHelp()
+		case "":
+		default:
+			fmt.Fprintf(d.out, "Error: unknown command %q, try help\n", cmd)
+		}
+	}
+}
+
+func splitCommand(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		return line[:i], strings.TrimSpace(line[i+1:])
+	}
+	return line, ""
+}
+
+func frameName(ctx engine.Context) string {
+	if stack := engine.GetCallStack(ctx); stack != nil {
+		if top, ok := stack.Top(); ok {
+			return top.String()
+		}
+	}
+	return "top level"
+}
+
+func (d *Debugger) printStop(ctx engine.Context, r engine.Redex) {
+	src := r.String()
+	// cut by runes, not to split a multibyte character
+	if runes := []rune(src); len(runes) > maxExpLength {
+		src = string(runes[:maxExpLength-3]) + "..."
+	}
+	fmt.Fprintf(d.out, "stopped at %s in %s: %s\n", r.Span.String(), frameName(ctx), src)
+}
+
+func (d *Debugger) printBacktrace(ctx engine.Context, r engine.Redex) {
+	var frames []engine.Frame
+	if stack := engine.GetCallStack(ctx); stack != nil {
+		frames = stack.Frames()
+	}
+	fmt.Fprint(d.out, engine.FormatTrace(frames, r.Span))
+}
+
+// printEnv prints the env chain, innermost first, up to an env that cannot be inspected
+func (d *Debugger) printEnv(env engine.Env) {
+	for i, e := 0, env; e != nil; i++ {
+		inspector, ok := e.(engine.EnvInspector)
+		if !ok {
+			fmt.Fprintf(d.out, "#%d: not inspectable\n", i)
+			return
+		}
+		d.printFrame(i, inspector.Local())
+		e = inspector.Parent()
+	}
+}
+
+func (d *Debugger) printFrame(i int, local map[string]Exp) {
+	if len(local) > maxEnvNames {
+		fmt.Fprintf(d.out, "#%d: %d names\n", i, len(local))
+		return
+	}
+	fmt.Fprintf(d.out, "#%d:\n", i)
+	names := make([]string, 0, len(local))
+	for name := range local {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(d.out, "\t%s = %s\n", name, local[name].String())
+	}
+}
+
+// print evaluates a json expression in the stopped env
+func (d *Debugger) print(ctx engine.Context, env engine.Env, src string) {
+	exp, err := d.parser.Parse(engine.NewContext(nil), strings.NewReader(src))
+	if err != nil {
+		fmt.Fprintf(d.out, "Error: %s\n", err.Error())
+		return
+	}
+
+	d.evaluating = true
+	defer func() {
+		d.evaluating = false
+	}()
+	// not charged to the meter of the stopped program, nor canceled with it
+	evalCtx := kernel.EnsureEvalLevel(ctx, kernel.ExprLevel).NewChild(map[string]interface{}{
+		engine.MeterKey:     nil,
+		engine.GoContextKey: nil,
+	})
+	val, err := d.interp.Interpret(evalCtx, exp, env)
+	if err != nil {
+		fmt.Fprintf(d.out, "Error: %s\n", err.Error())
+		return
+	}
+	fmt.Fprintf(d.out, "Value: %s\n", val.String())
+}
+
+func (d *Debugger) printHelp() {
+	fmt.Fprint(d.out, `s, step              stop at the next redex
+n, next              stop at the next line of this function
+o, out               stop after this function returns
+c, continue          run until a breakpoint
+b, break SPEC        break at function name, line or file:line
+d, delete SPEC       delete a breakpoint
+bt, backtrace        print the call stack
+env                  print names in scope, innermost first
+p, print EXP         evaluate a json expression here
+q, quit              abort the evaluation
+`)
+}
@@ -0,0 +1,182 @@
+package debugger
+
+import (
+	"bytes"
+	gocontext "context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/crcc/jsonp/engine"
+	"github.com/crcc/jsonp/kernel"
+)
+
+const program = `{"begin": [
+	{"def": {"sq": {"func": [["x"], ["*", "x", "x"]]}}},
+	{"def": {"f": {"func": [["y"],
+		{"def": {"z": ["sq", "y"]}},
+		["+", "z", 1]]}}},
+	["f", 3]
+]}`
+
+// debug evaluates program with commands, it gives the value and the output of debugger
+func debug(t *testing.T, commands string) (Exp, string, error) {
+	var out bytes.Buffer
+	d := New(engine.ParserFunc(kernel.ParseJson), strings.NewReader(commands), &out)
+	interp := kernel.NewKernelInterpreter()
+	if err := d.Attach(interp); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := New(nil, nil, nil).Attach(interp); err != ErrAlreadyAttached {
+		t.Fatalf("expect already attached, but found %v", err)
+	}
+
+	exp, err := kernel.ParseJson(engine.NewContext(nil), strings.NewReader(program))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ctx := engine.NewContext(map[string]interface{}{
+		kernel.EvalLevelKey: kernel.TopLevel,
+	})
+	val, err := kernel.EvalTopLevel(ctx, interp, exp, make(map[string]Exp))
+	return val, out.String(), err
+}
+
+// stops gives "span in frame" of each stop
+func stops(out string) string {
+	var result []string
+	for _, line := range strings.Split(out, "\n") {
+		i := strings.Index(line, "stopped at ")
+		if i < 0 {
+			continue
+		}
+		result = append(result, strings.SplitN(line[i+len("stopped at "):], ": ", 2)[0])
+	}
+	return strings.Join(result, ", ")
+}
+
+func expectStops(t *testing.T, commands string, expected string) string {
+	val, out, err := debug(t, commands)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "10" {
+		t.Fatalf("expect 10, but found %s", val.String())
+	}
+	if stops(out) != expected {
+		t.Fatalf("%q: expect stops %s, but found %s\n%s", commands, expected, stops(out), out)
+	}
+	return out
+}
+
+func TestDebugger_Step(t *testing.T) {
+	expectStops(t, "n\nn\nn\nn\nn\n", "1:1 in top level, 2:2 in top level, 3:2 in top level, 6:2 in top level")
+	expectStops(t, "n\nn\nn\ns\ns\ns\ns\ns\n",
+		"1:1 in top level, 2:2 in top level, 3:2 in top level, 6:2 in top level, 3:16 in f, 4:3 in f, 4:17 in f, 2:34 in sq, 5:3 in f")
+	// out of sq, then out of f
+	expectStops(t, "b sq\nc\no\no\n", "1:1 in top level, 2:34 in sq, 5:3 in f")
+}
+
+func TestDebugger_Breakpoints(t *testing.T) {
+	expectStops(t, "b 5\nc\nc\n", "1:1 in top level, 5:3 in f")
+	expectStops(t, "b f\nb 2\nc\nd 2\nc\nc\n", "1:1 in top level, 2:2 in top level, 3:16 in f")
+	expectStops(t, "b <input>:5\nc\n", "1:1 in top level")
+
+	_, out, _ := debug(t, "b\nd sq\nx\nc\n")
+	for _, msg := range []string{
+		"Error: expect function name, line or file:line",
+		"Error: no such breakpoint: sq",
+		`Error: unknown command "x", try help`,
+	} {
+		if !strings.Contains(out, msg) {
+			t.Fatalf("expect %s, but found\n%s", msg, out)
+		}
+	}
+}
+
+func TestDebugger_Inspect(t *testing.T) {
+	out := expectStops(t, "b sq\nc\nenv\np [\"+\", \"x\", 1]\np [\"+\", \"w\", 1]\nbt\nc\n", "1:1 in top level, 2:34 in sq")
+	for _, msg := range []string{
+		"#0:\n\tx = 3\n",
+		"Value: 4\n",
+		`Name Not Found: "w"`,
+		"sq(...)\n\t2:34\nf(...)\n\t4:17\ntop level\n\t6:2\n",
+	} {
+		if !strings.Contains(out, msg) {
+			t.Fatalf("expect %q, but found\n%s", msg, out)
+		}
+	}
+}
+
+// opaque hides the optional interfaces of what it wraps
+type opaqueInterpreter struct {
+	engine.Interpreter
+}
+
+type opaqueEnv struct {
+	engine.Env
+}
+
+func TestDebugger_Optional(t *testing.T) {
+	d := New(nil, nil, nil)
+	if err := d.Attach(opaqueInterpreter{kernel.NewKernelInterpreter()}); err != ErrNotDebuggable {
+		t.Fatalf("expect not debuggable, but found %v", err)
+	}
+
+	var out bytes.Buffer
+	d.out = &out
+	env := engine.NewEnv(map[string]Exp{"x": engine.NewInteger(1)})
+	d.printEnv(opaqueEnv{env}.Extend(nil))
+	d.printEnv(opaqueEnv{env})
+	expected := "#0:\n#1:\n\tx = 1\n#0: not inspectable\n"
+	if out.String() != expected {
+		t.Fatalf("expect %q, but found %q", expected, out.String())
+	}
+}
+
+func TestDebugger_PrintStop(t *testing.T) {
+	exp, err := kernel.ParseJson(engine.NewContext(nil), strings.NewReader(`["f", {"data": "`+strings.Repeat("世界", 50)+`"}]`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var out bytes.Buffer
+	d := New(nil, nil, &out)
+	d.printStop(engine.NewContext(nil), exp.(engine.Redex))
+	src := strings.SplitN(strings.TrimSuffix(out.String(), "\n"), ": ", 2)[1]
+	if !utf8.ValidString(src) || utf8.RuneCountInString(src) != maxExpLength || !strings.HasSuffix(src, "...") {
+		t.Fatalf("expect %d runes ending with ..., but found %q", maxExpLength, src)
+	}
+}
+
+func TestDebugger_PrintUnmetered(t *testing.T) {
+	var out bytes.Buffer
+	d := New(engine.ParserFunc(kernel.ParseJson), nil, &out)
+	d.interp = kernel.NewKernelInterpreter()
+	ctx, meter := engine.WithLimits(engine.NewContext(map[string]interface{}{
+		kernel.EvalLevelKey: kernel.TopLevel,
+	}), engine.Limits{MaxSteps: 1})
+	goCtx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+	ctx = engine.WithGoContext(ctx, goCtx)
+	env := engine.NewEnv(map[string]Exp{"x": engine.NewInteger(1)})
+
+	d.print(ctx, env, `{"if": [true, {"if": [true, "x", 0]}, 0]}`)
+	if out.String() != "Value: 1\n" {
+		t.Fatalf("expect value 1, but found %q", out.String())
+	}
+	if steps := meter.Usage().Steps; steps != 0 {
+		t.Fatalf("expect no steps charged, but found %d", steps)
+	}
+	if d.evaluating {
+		t.Fatal("expect evaluating reset")
+	}
+}
+
+func TestDebugger_Quit(t *testing.T) {
+	_, _, err := debug(t, "b sq\nc\nq\n")
+	if !errors.Is(err, ErrQuit) {
+		t.Fatalf("expect quit, but found %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+)
+
+// evaluation is canceled when the go context in Context is done
+
+const GoContextKey = "go-context"
+
+// CancelError is returned when evaluation is canceled, Cause is the error of the go context,
+// gocontext.Canceled or gocontext.DeadlineExceeded
+type CancelError struct {
+	Cause error
+}
+
+func (e *CancelError) Error() string {
+	return fmt.Sprintf("evaluation canceled: %s", e.Cause.Error())
+}
+
+func (e *CancelError) Unwrap() error {
+	return e.Cause
+}
+
+func IsCanceled(err error) bool {
+	var cancelErr *CancelError
+	return errors.As(err, &cancelErr)
+}
+
+// WithGoContext makes a child context, evaluated in which is canceled with goCtx
+func WithGoContext(ctx Context, goCtx gocontext.Context) Context {
+	return ctx.NewChild(map[string]interface{}{
+		GoContextKey: goCtx,
+	})
+}
+
+// GoContext gives the go context of ctx, nil if not set
+func GoContext(ctx Context) gocontext.Context {
+	v := ctx.Get(GoContextKey)
+	if v == nil {
+		return nil
+	}
+	return v.(gocontext.Context)
+}
+
+// CheckCanceled gives CancelError if ctx is canceled, long running primitives should check it
+func CheckCanceled(ctx Context) error {
+	goCtx := GoContext(ctx)
+	if goCtx == nil {
+		return nil
+	}
+	return checkDone(goCtx)
+}
+
+func checkDone(goCtx gocontext.Context) error {
+	select {
+	case <-goCtx.Done():
+		return &CancelError{Cause: goCtx.Err()}
+	default:
+		return nil
+	}
+}
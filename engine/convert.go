@@ -0,0 +1,379 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// conversion between values and go values, structs are converted by their json tags
+
+var (
+	expType    = reflect.TypeOf((*Exp)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+	bigRatType = reflect.TypeOf((*big.Rat)(nil))
+)
+
+var ErrInvalidUnmarshalTarget = errors.New("Invalid Unmarshal Target")
+
+// FromGo converts a go value to a value, the inverse of Unmarshal
+func FromGo(v interface{}) (Exp, error) {
+	return FromGoValue(reflect.ValueOf(v))
+}
+
+// Unmarshal converts a value into target, which should be a non nil pointer
+func Unmarshal(val Exp, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return ErrInvalidUnmarshalTarget
+	}
+	result, err := ToGoValue(val, v.Type().Elem())
+	if err != nil {
+		return err
+	}
+	v.Elem().Set(result)
+	return nil
+}
+
+// elements of a list value, or a list expression of values
+func listElems(val Exp) ([]Exp, bool) {
+	switch l := val.(type) {
+	case List:
+		return l, true
+	case ListEx:
+		return l, true
+	default:
+		return nil, false
+	}
+}
+
+// entries of a map value, or a map expression of values.
+// a suspended redex is a map of a single entry.
+func mapEntries(val Exp) (map[string]Exp, bool) {
+	switch m := val.(type) {
+	case Map:
+		return m, true
+	case MapEx:
+		return m, true
+	case SuspendVal:
+		return map[string]Exp{m.Name: m.Exp}, true
+	case Redex:
+		return map[string]Exp{m.Name: m.Exp}, true
+	default:
+		return nil, false
+	}
+}
+
+func convertError(val Exp, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %s to %s", val.String(), t.String())
+}
+
+// json name of struct field, empty if skipped
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	parts := strings.Split(tag, ",")
+	omitEmpty := false
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	if parts[0] != "" {
+		return parts[0], omitEmpty
+	}
+	return f.Name, omitEmpty
+}
+
+// ToGoValue converts a value to a go value of type t
+func ToGoValue(val Exp, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface && t.Implements(expType) {
+		if !reflect.TypeOf(val).Implements(t) {
+			return reflect.Value{}, convertError(val, t)
+		}
+		return reflect.ValueOf(val).Convert(t), nil
+	}
+
+	switch t {
+	case bigIntType:
+		i, err := ToInteger(val)
+		if err != nil {
+			return reflect.Value{}, convertError(val, t)
+		}
+		return reflect.ValueOf(i.BigInt()), nil
+	case bigRatType:
+		n, err := ToNumeric(val)
+		if err != nil || (n.Rank() == FloatRank && (IsInf(val) || IsNaN(val))) {
+			return reflect.Value{}, convertError(val, t)
+		}
+		return reflect.ValueOf(new(big.Rat).Set(toRat(n))), nil
+	}
+
+	result := reflect.New(t).Elem()
+	// null is nil, as FromGoValue gives null for nil
+	if val.Kind() == NullValue {
+		switch t.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Ptr, reflect.Interface:
+			return result, nil
+		}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		b, err := ToBoolean(val)
+		if err != nil {
+			return reflect.Value{}, convertError(val, t)
+		}
+		result.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := ToInteger(val)
+		if err != nil {
+			return reflect.Value{}, convertError(val, t)
+		}
+		n, ok := i.Int64()
+		if !ok || result.OverflowInt(n) {
+			return reflect.Value{}, convertError(val, t)
+		}
+		result.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, err := ToInteger(val)
+		if err != nil {
+			return reflect.Value{}, convertError(val, t)
+		}
+		bi := i.BigInt()
+		if bi.Sign() < 0 || !bi.IsUint64() || result.OverflowUint(bi.Uint64()) {
+			return reflect.Value{}, convertError(val, t)
+		}
+		result.SetUint(bi.Uint64())
+	case reflect.Float32, reflect.Float64:
+		f, err := ToNumber(val)
+		if err != nil {
+			return reflect.Value{}, convertError(val, t)
+		}
+		result.SetFloat(f)
+	case reflect.String:
+		s, err := ToString(val)
+		if err != nil {
+			return reflect.Value{}, convertError(val, t)
+		}
+		result.SetString(s)
+	case reflect.Slice:
+		l, ok := listElems(val)
+		if !ok {
+			return reflect.Value{}, convertError(val, t)
+		}
+		result.Set(reflect.MakeSlice(t, len(l), len(l)))
+		for i, sub := range l {
+			elem, err := ToGoValue(sub, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.Index(i).Set(elem)
+		}
+	case reflect.Map:
+		m, ok := mapEntries(val)
+		if !ok || t.Key().Kind() != reflect.String {
+			return reflect.Value{}, convertError(val, t)
+		}
+		result.Set(reflect.MakeMapWithSize(t, len(m)))
+		for name, sub := range m {
+			elem, err := ToGoValue(sub, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.SetMapIndex(reflect.ValueOf(name).Convert(t.Key()), elem)
+		}
+	case reflect.Struct:
+		m, ok := mapEntries(val)
+		if !ok {
+			return reflect.Value{}, convertError(val, t)
+		}
+		for i := 0; i < t.NumField(); i++ {
+			name, _ := fieldName(t.Field(i))
+			sub, ok := m[name]
+			if name == "" || !ok {
+				continue
+			}
+			field, err := ToGoValue(sub, t.Field(i).Type)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.Field(i).Set(field)
+		}
+	case reflect.Ptr:
+		elem, err := ToGoValue(val, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		result.Set(reflect.New(t.Elem()))
+		result.Elem().Set(elem)
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return reflect.Value{}, convertError(val, t)
+		}
+		v, err := ToGo(val)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if v != nil {
+			result.Set(reflect.ValueOf(v))
+		}
+	default:
+		return reflect.Value{}, convertError(val, t)
+	}
+	return result, nil
+}
+
+// ToGo converts a value to a json like go value:
+// nil, bool, int64, *big.Int, *big.Rat, float64, string, []interface{} or map[string]interface{}.
+// decimals and rationals that are not integers are *big.Rat, so they keep their exact value.
+// list and map expressions of values are converted as lists and maps,
+// suspended redexes as {name: exp}.
+func ToGo(val Exp) (interface{}, error) {
+	if l, ok := listElems(val); ok {
+		result := make([]interface{}, len(l))
+		for i, sub := range l {
+			v, err := ToGo(sub)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = v
+		}
+		return result, nil
+	}
+	if m, ok := mapEntries(val); ok {
+		result := make(map[string]interface{}, len(m))
+		for name, sub := range m {
+			v, err := ToGo(sub)
+			if err != nil {
+				return nil, err
+			}
+			result[name] = v
+		}
+		return result, nil
+	}
+
+	switch val.Kind() {
+	case NullValue:
+		return nil, nil
+	case BooleanValue:
+		return ToBoolean(val)
+	case NumberValue:
+		if i, err := ToInteger(val); err == nil {
+			if n, ok := i.Int64(); ok {
+				return n, nil
+			}
+			return i.BigInt(), nil
+		}
+		// exact numbers are not rounded to float64
+		n, err := ToNumeric(val)
+		if err != nil {
+			return nil, err
+		}
+		if n.Rank() != FloatRank {
+			return new(big.Rat).Set(toRat(n)), nil
+		}
+		return ToNumber(val)
+	case StringValue:
+		return ToString(val)
+	default:
+		return nil, fmt.Errorf("cannot convert %s to go value", val.String())
+	}
+}
+
+// FromGoValue converts a go value to a value, nil pointers, slices and maps are null
+func FromGoValue(v reflect.Value) (Exp, error) {
+	if !v.IsValid() {
+		return NewNull(), nil
+	}
+	if v.Type().Implements(expType) {
+		if v.Kind() == reflect.Interface && v.IsNil() {
+			return NewNull(), nil
+		}
+		return v.Interface().(Exp), nil
+	}
+
+	switch v.Type() {
+	case bigIntType:
+		if v.IsNil() {
+			return NewNull(), nil
+		}
+		return NewBigInteger(v.Interface().(*big.Int)), nil
+	case bigRatType:
+		if v.IsNil() {
+			return NewNull(), nil
+		}
+		return NewRational(v.Interface().(*big.Rat)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return NewBoolean(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewInteger(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NewBigInteger(new(big.Int).SetUint64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return NewFloat(v.Float()), nil
+	case reflect.String:
+		return NewString(v.String()), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NewNull(), nil
+		}
+		l := make([]Exp, v.Len())
+		for i := range l {
+			sub, err := FromGoValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			l[i] = sub
+		}
+		return NewList(l), nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("cannot convert %s to value, map key should be string", v.Type().String())
+		}
+		if v.IsNil() {
+			return NewNull(), nil
+		}
+		m := make(map[string]Exp, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			sub, err := FromGoValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			m[iter.Key().String()] = sub
+		}
+		return NewMap(m), nil
+	case reflect.Struct:
+		t := v.Type()
+		m := make(map[string]Exp, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			name, omitEmpty := fieldName(t.Field(i))
+			if name == "" || (omitEmpty && v.Field(i).IsZero()) {
+				continue
+			}
+			sub, err := FromGoValue(v.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			m[name] = sub
+		}
+		return NewMap(m), nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return NewNull(), nil
+		}
+		return FromGoValue(v.Elem())
+	default:
+		return nil, fmt.Errorf("cannot convert %s to value", v.Type().String())
+	}
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+type convertPoint struct {
+	X     int      `json:"x"`
+	Y     float64  `json:"y"`
+	Label string   `json:"label,omitempty"`
+	Tags  []string `json:"tags"`
+	Next  *convertPoint
+	Skip  int `json:"-"`
+}
+
+func TestFromGo(t *testing.T) {
+	for v, expected := range map[interface{}]string{
+		nil:             "null",
+		true:            "true",
+		42:              "42",
+		uint64(1 << 63): "9223372036854775808",
+		1.5:             "1.5",
+		"abc":           `"abc"`,
+	} {
+		val, err := FromGo(v)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if val.String() != expected {
+			t.Fatalf("expect %s, but found %s", expected, val.String())
+		}
+	}
+
+	val, err := FromGo(convertPoint{X: 1, Y: 2.5, Skip: 3})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected := `{"Next": null, "tags": null, "x": 1, "y": 2.5}`; val.String() != expected {
+		t.Fatalf("expect %s, but found %s", expected, val.String())
+	}
+
+	val, err = FromGo(map[string][]*big.Int{"a": {big.NewInt(1), nil}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected := `{"a": [1, null]}`; val.String() != expected {
+		t.Fatalf("expect %s, but found %s", expected, val.String())
+	}
+
+	if _, err := FromGo(map[int]int{1: 2}); err == nil {
+		t.Fatal("expect error converting map of int keys")
+	}
+}
+
+func TestToGo(t *testing.T) {
+	val := NewMapExp(map[string]Exp{
+		"list":   NewListExp([]Exp{NewInteger(1), NewFloat(1.5), NewNull()}),
+		"big":    NewBigInteger(new(big.Int).Lsh(big.NewInt(1), 64)),
+		"exact":  NewListExp([]Exp{mustParseDecimal("0.1"), NewRational(big.NewRat(1, 3))}),
+		"quoted": NewSuspendValue(NewRedex("add", NewList([]Exp{NewString("a"), NewBoolean(true)}))),
+	})
+	v, err := ToGo(val)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := map[string]interface{}{
+		"list":   []interface{}{int64(1), 1.5, nil},
+		"big":    new(big.Int).Lsh(big.NewInt(1), 64),
+		"exact":  []interface{}{big.NewRat(1, 10), big.NewRat(1, 3)},
+		"quoted": map[string]interface{}{"add": []interface{}{"a", true}},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("expect %v, but found %v", expected, v)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	val := NewMap(map[string]Exp{
+		"x":    NewInteger(1),
+		"y":    NewInteger(2),
+		"tags": NewListExp([]Exp{NewString("a"), NewString("b")}),
+		"Next": NewMap(map[string]Exp{"x": NewInteger(3), "y": NewFloat(0.5)}),
+		"Skip": NewInteger(4),
+	})
+	var p convertPoint
+	if err := Unmarshal(val, &p); err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := convertPoint{X: 1, Y: 2, Tags: []string{"a", "b"}, Next: &convertPoint{X: 3, Y: 0.5}}
+	if !reflect.DeepEqual(p, expected) {
+		t.Fatalf("expect %+v, but found %+v", expected, p)
+	}
+
+	// round trip
+	back, err := FromGo(p)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var p2 convertPoint
+	if err := Unmarshal(back, &p2); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(p, p2) {
+		t.Fatalf("expect %+v, but found %+v", p, p2)
+	}
+
+	var r *big.Rat
+	if err := Unmarshal(mustParseDecimal("0.25"), &r); err != nil || r.String() != "1/4" {
+		t.Fatalf("expect 1/4, but found %v, %v", r, err)
+	}
+
+	for _, target := range []interface{}{nil, p, (*convertPoint)(nil)} {
+		if err := Unmarshal(val, target); err != ErrInvalidUnmarshalTarget {
+			t.Fatalf("expect invalid target error for %T", target)
+		}
+	}
+
+	var n int8
+	if err := Unmarshal(NewInteger(300), &n); err == nil {
+		t.Fatal("expect overflow error")
+	}
+	var s string
+	if err := Unmarshal(NewInteger(1), &s); err == nil {
+		t.Fatal("expect conversion error")
+	}
+}
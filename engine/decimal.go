@@ -0,0 +1,328 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal, value is unscaled * 10^-scale, arithmetic is exact except division
+
+// scales and exponents beyond this are refused, as their digits would not fit in memory
+const MaxDecimalScale = 10000
+
+var ErrDecimalScaleOutOfRange = errors.New("Decimal Scale Out Of Range")
+
+type RoundingMode uint8
+
+const (
+	RoundHalfEven RoundingMode = iota
+	RoundHalfUp
+	RoundHalfDown
+	// away from zero
+	RoundUp
+	// toward zero
+	RoundDown
+	RoundCeiling
+	RoundFloor
+)
+
+var roundingModeNames = []string{
+	RoundHalfEven: "half-even",
+	RoundHalfUp:   "half-up",
+	RoundHalfDown: "half-down",
+	RoundUp:       "up",
+	RoundDown:     "down",
+	RoundCeiling:  "ceiling",
+	RoundFloor:    "floor",
+}
+
+func (m RoundingMode) String() string {
+	return roundingModeNames[m]
+}
+
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	for i, name := range roundingModeNames {
+		if name == s {
+			return RoundingMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown rounding mode: %s", s)
+}
+
+type DecimalContext struct {
+	// fraction digits kept when a quotient is not exact
+	Precision int32
+	Rounding  RoundingMode
+}
+
+// DefaultDecimalContext is used by decimal division if no context is given
+func DefaultDecimalContext() DecimalContext {
+	return DecimalContext{
+		Precision: 16,
+		Rounding:  RoundHalfEven,
+	}
+}
+
+// CheckDecimalScale gives ErrDecimalScaleOutOfRange if scale is beyond MaxDecimalScale
+func CheckDecimalScale(scale int64) error {
+	if scale < -MaxDecimalScale || scale > MaxDecimalScale {
+		return ErrDecimalScaleOutOfRange
+	}
+	return nil
+}
+
+const DecimalContextKey = "decimal-context"
+
+// WithDecimalContext makes a child context, decimals in which are rounded with dc
+func WithDecimalContext(ctx Context, dc DecimalContext) Context {
+	return ctx.NewChild(map[string]interface{}{
+		DecimalContextKey: dc,
+	})
+}
+
+// GetDecimalContext gives the decimal context of ctx, DefaultDecimalContext if not set
+func GetDecimalContext(ctx Context) DecimalContext {
+	v := ctx.Get(DecimalContextKey)
+	if v == nil {
+		return DefaultDecimalContext()
+	}
+	return v.(DecimalContext)
+}
+
+type Decimal struct {
+	unscaled *big.Int
+	scale    int32
+}
+
+func (d Decimal) Kind() Kind {
+	return NumberValue
+}
+
+func (d Decimal) Equal(v Exp) bool {
+	return equalNumber(d, v)
+}
+
+func (d Decimal) String() string {
+	s := new(big.Int).Abs(d.unscaled).String()
+	if d.scale > 0 {
+		if len(s) <= int(d.scale) {
+			s = strings.Repeat("0", int(d.scale)-len(s)+1) + s
+		}
+		s = s[:len(s)-int(d.scale)] + "." + s[len(s)-int(d.scale):]
+	}
+	if d.unscaled.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+func (d Decimal) Rank() NumberRank {
+	return DecimalRank
+}
+
+func (d Decimal) Float64() float64 {
+	f, _ := d.Rat().Float64()
+	return f
+}
+
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+func (d Decimal) Unscaled() *big.Int {
+	return new(big.Int).Set(d.unscaled)
+}
+
+func (d Decimal) Rat() *big.Rat {
+	r := new(big.Rat).SetInt(d.unscaled)
+	return r.Quo(r, new(big.Rat).SetInt(pow10(d.scale)))
+}
+
+// Round rounds d to scale fraction digits
+func (d Decimal) Round(scale int32, mode RoundingMode) Decimal {
+	if scale >= d.scale {
+		return d.rescale(scale)
+	}
+	return roundRat(d.Rat(), scale, mode)
+}
+
+// increase scale without changing value
+func (d Decimal) rescale(scale int32) Decimal {
+	if scale <= d.scale {
+		return d
+	}
+	u := new(big.Int).Mul(d.unscaled, pow10(scale-d.scale))
+	return Decimal{unscaled: u, scale: scale}
+}
+
+func NewDecimal(unscaled *big.Int, scale int32) Decimal {
+	if scale < 0 {
+		return Decimal{unscaled: new(big.Int).Mul(unscaled, pow10(-scale)), scale: 0}
+	}
+	return Decimal{unscaled: new(big.Int).Set(unscaled), scale: scale}
+}
+
+var ErrNotDecimalValue = errors.New("Not Decimal Value")
+
+func ToDecimal(v Exp) (Decimal, error) {
+	d, ok := v.(Decimal)
+	if !ok {
+		return Decimal{}, NewTypeError(NumberValue, v, ErrNotDecimalValue)
+	}
+	return d, nil
+}
+
+// ParseDecimal parses decimal literal like "-12.34" or "1.5e-3" exactly
+func ParseDecimal(s string) (Decimal, error) {
+	mantissa, exp := s, int64(0)
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		mantissa = s[:i]
+		exp, err = strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, ErrInvalidNumber
+		}
+	}
+
+	var scale int64
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		scale = int64(len(mantissa) - i - 1)
+		mantissa = mantissa[:i] + mantissa[i+1:]
+	}
+	if mantissa == "" || mantissa == "-" || mantissa == "+" {
+		return Decimal{}, ErrInvalidNumber
+	}
+
+	u, ok := new(big.Int).SetString(mantissa, 10)
+	if !ok {
+		return Decimal{}, ErrInvalidNumber
+	}
+	if err := CheckDecimalScale(scale - exp); err != nil {
+		return Decimal{}, err
+	}
+	return NewDecimal(u, int32(scale-exp)), nil
+}
+
+// NumberToDecimal converts any number into decimal,
+// floats are converted by their shortest representation,
+// non terminating rationals are rounded with ctx.
+func NumberToDecimal(v Exp, ctx DecimalContext) (Decimal, error) {
+	n, err := ToNumeric(v)
+	if err != nil {
+		return Decimal{}, err
+	}
+
+	switch n := n.(type) {
+	case Decimal:
+		return n, nil
+	case Integer:
+		return NewDecimal(n.BigInt(), 0), nil
+	case Rational:
+		return ratToDecimal(n.r, ctx), nil
+	default:
+		s := n.String()
+		if s == "null" {
+			return Decimal{}, fmt.Errorf("cannot convert %g to decimal", n.Float64())
+		}
+		return ParseDecimal(s)
+	}
+}
+
+// terminating rationals with more fraction digits than MaxDecimalScale are rounded with ctx too
+func ratToDecimal(r *big.Rat, ctx DecimalContext) Decimal {
+	if digits, ok := decimalDigits(r.Denom()); ok && digits <= MaxDecimalScale {
+		return roundRat(r, int32(digits), RoundDown)
+	}
+	return roundRat(r, ctx.Precision, ctx.Rounding)
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func roundRat(r *big.Rat, scale int32, mode RoundingMode) Decimal {
+	// r * 10^scale = q + rem/den
+	num := new(big.Int).Mul(r.Num(), pow10(scale))
+	den := r.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() == 0 {
+		return Decimal{unscaled: q, scale: scale}
+	}
+
+	sign := num.Sign()
+	// compare 2*|rem| with den
+	half := new(big.Int).Abs(rem)
+	half.Lsh(half, 1)
+	cmpHalf := half.Cmp(den)
+
+	var away bool
+	switch mode {
+	case RoundHalfEven:
+		away = cmpHalf > 0 || (cmpHalf == 0 && q.Bit(0) == 1)
+	case RoundHalfUp:
+		away = cmpHalf >= 0
+	case RoundHalfDown:
+		away = cmpHalf > 0
+	case RoundUp:
+		away = true
+	case RoundDown:
+		away = false
+	case RoundCeiling:
+		away = sign > 0
+	case RoundFloor:
+		away = sign < 0
+	}
+
+	if away {
+		q.Add(q, big.NewInt(int64(sign)))
+	}
+	return Decimal{unscaled: q, scale: scale}
+}
+
+func decimalOp(op func(z, a, b *big.Int) *big.Int, d1, d2 Decimal) Decimal {
+	scale := d1.scale
+	if d2.scale > scale {
+		scale = d2.scale
+	}
+	d1, d2 = d1.rescale(scale), d2.rescale(scale)
+	return Decimal{unscaled: op(new(big.Int), d1.unscaled, d2.unscaled), scale: scale}
+}
+
+// the scale of a product is the sum of scales, it is refused beyond MaxDecimalScale instead of wrapping
+func decimalMul(d1, d2 Decimal) (Decimal, error) {
+	scale := int64(d1.scale) + int64(d2.scale)
+	if err := CheckDecimalScale(scale); err != nil {
+		return Decimal{}, err
+	}
+	return Decimal{unscaled: new(big.Int).Mul(d1.unscaled, d2.unscaled), scale: int32(scale)}, nil
+}
+
+func toDecimal(n Numeric) Decimal {
+	d, _ := NumberToDecimal(n, DefaultDecimalContext())
+	return d
+}
+
+// DivDecimal divides a by b, the quotient is exact if it terminates, otherwise rounded with ctx
+func DivDecimal(a, b Exp, ctx DecimalContext) (Exp, error) {
+	n1, n2, _, err := toNumerics(a, b)
+	if err != nil {
+		return nil, err
+	}
+	if isZero(n2) {
+		return nil, ErrDivisionByZero
+	}
+
+	d1, err := NumberToDecimal(n1, ctx)
+	if err != nil {
+		return nil, err
+	}
+	d2, err := NumberToDecimal(n2, ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := new(big.Rat).Quo(toRat(d1), toRat(d2))
+	return ratToDecimal(r, ctx), nil
+}
@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"testing"
+)
+
+func mustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err.Error())
+	}
+	return d
+}
+
+func TestParseDecimal(t *testing.T) {
+	for s, expected := range map[string]string{
+		"0.1":    "0.1",
+		"-12.30": "-12.30",
+		"0.005":  "0.005",
+		"1.5e-3": "0.0015",
+		"2e2":    "200",
+		"42":     "42",
+	} {
+		if d := mustParseDecimal(s); d.String() != expected {
+			t.Fatalf("expect %s, but found %s", expected, d.String())
+		}
+	}
+
+	for _, s := range []string{"", "-", "1.2.3", "abc", "1e"} {
+		if _, err := ParseDecimal(s); err == nil {
+			t.Fatalf("expect error parsing %q", s)
+		}
+	}
+
+	for _, s := range []string{"1e999999999", "1e-999999999", "1e10001"} {
+		if _, err := ParseDecimal(s); err != ErrDecimalScaleOutOfRange {
+			t.Fatalf("expect scale out of range parsing %q, but found %v", s, err)
+		}
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	n, err := AddNumber(mustParseDecimal("0.1"), mustParseDecimal("0.2"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.String() != "0.3" {
+		t.Fatalf("expect 0.3, but found %s", n.String())
+	}
+
+	n, err = MulNumber(mustParseDecimal("19.99"), NewInteger(3))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.String() != "59.97" {
+		t.Fatalf("expect 59.97, but found %s", n.String())
+	}
+
+	// non terminating quotient is rounded with default context
+	n, err = DivNumber(mustParseDecimal("1"), NewInteger(3))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.String() != "0.3333333333333333" {
+		t.Fatalf("expect 0.3333333333333333, but found %s", n.String())
+	}
+
+	n, err = DivDecimal(mustParseDecimal("2"), NewInteger(3), DecimalContext{Precision: 2, Rounding: RoundDown})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.String() != "0.66" {
+		t.Fatalf("expect 0.66, but found %s", n.String())
+	}
+
+	n, err = PowNumberWith(mustParseDecimal("3"), NewInteger(-1), DecimalContext{Precision: 3, Rounding: RoundUp})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.String() != "0.334" {
+		t.Fatalf("expect 0.334, but found %s", n.String())
+	}
+
+	if _, err := PowNumber(mustParseDecimal("0.5"), NewInteger(100000)); err != ErrDecimalScaleOutOfRange {
+		t.Fatal("expect scale out of range")
+	}
+
+	// scales of products are bounded instead of wrapping
+	var sq Exp = mustParseDecimal("1e-2500")
+	for i := 0; i < 17; i++ {
+		if sq, err = MulNumber(sq, sq); err != nil {
+			break
+		}
+		if d := sq.(Decimal); d.Scale() <= 0 {
+			t.Fatalf("expect positive scale, but found %d", d.Scale())
+		}
+	}
+	if err != ErrDecimalScaleOutOfRange {
+		t.Fatalf("expect scale out of range, but found %v", err)
+	}
+
+	if _, err := DivNumber(mustParseDecimal("1"), mustParseDecimal("0.00")); err != ErrDivisionByZero {
+		t.Fatal("expect division by zero")
+	}
+
+	// float is contagious
+	if n, _ := AddNumber(mustParseDecimal("0.5"), NewFloat(0.25)); n.(Numeric).Rank() != FloatRank {
+		t.Fatal("expect float")
+	}
+}
+
+func TestDecimalRound(t *testing.T) {
+	cases := []struct {
+		value    string
+		mode     RoundingMode
+		expected string
+	}{
+		{"2.345", RoundHalfEven, "2.34"},
+		{"2.355", RoundHalfEven, "2.36"},
+		{"2.345", RoundHalfUp, "2.35"},
+		{"2.345", RoundHalfDown, "2.34"},
+		{"-2.341", RoundUp, "-2.35"},
+		{"-2.349", RoundDown, "-2.34"},
+		{"-2.341", RoundCeiling, "-2.34"},
+		{"-2.341", RoundFloor, "-2.35"},
+		{"2.3", RoundHalfEven, "2.30"},
+	}
+	for _, c := range cases {
+		if d := mustParseDecimal(c.value).Round(2, c.mode); d.String() != c.expected {
+			t.Fatalf("round %s %s: expect %s, but found %s", c.value, c.mode, c.expected, d.String())
+		}
+	}
+}
+
+func TestCompareDecimal(t *testing.T) {
+	if !mustParseDecimal("1.50").Equal(mustParseDecimal("1.5")) {
+		t.Fatal("expect 1.50 = 1.5")
+	}
+	if !mustParseDecimal("2.00").Equal(NewInteger(2)) {
+		t.Fatal("expect 2.00 = 2")
+	}
+	if !mustParseDecimal("0.1").Equal(NewFloat(0.1)) {
+		t.Fatal("expect decimal 0.1 = float 0.1")
+	}
+	f, _ := AddNumber(NewFloat(0.1), NewFloat(0.2))
+	if c, _ := CompareNumber(mustParseDecimal("0.3"), f); c >= 0 {
+		t.Fatal("expect 0.3 < 0.30000000000000004")
+	}
+	if c, _ := CompareNumber(mustParseDecimal("0.25"), mustParseNumber("1")); c >= 0 {
+		t.Fatal("expect 0.25 < 1")
+	}
+}
@@ -8,6 +8,19 @@ import (
 
 var ErrNameNotFound = errors.New("Name Not Found")
 
+// UnboundNameError is an error of a name not defined in any frame, it is ErrNameNotFound
+type UnboundNameError struct {
+	Name string
+}
+
+func (e *UnboundNameError) Error() string {
+	return fmt.Sprintf("%s: %q", ErrNameNotFound.Error(), e.Name)
+}
+
+func (e *UnboundNameError) Unwrap() error {
+	return ErrNameNotFound
+}
+
 type Env interface {
 	Get(name string) (Exp, error)
 	Set(name string, val Exp) error
@@ -17,6 +30,14 @@ type Env interface {
 	Protect() Env
 }
 
+// EnvInspector is implemented by envs whose frames can be listed, like by a debugger
+type EnvInspector interface {
+	// Local gives a copy of the innermost frame
+	Local() map[string]Exp
+	// Parent gives the env extended by this one, nil if outermost
+	Parent() Env
+}
+
 type env struct {
 	namespace map[string]Exp
 	parent    *env
@@ -33,7 +54,7 @@ func (e *env) findFrame(name string) (*env, Exp, error) {
 	if ok {
 		return frame, val, nil
 	}
-	return nil, nil, ErrNameNotFound
+	return nil, nil, &UnboundNameError{Name: name}
 }
 
 func (e *env) Get(name string) (Exp, error) {
@@ -64,6 +85,21 @@ func (e *env) Extend(kvs map[string]Exp) Env {
 	}
 }
 
+func (e *env) Local() map[string]Exp {
+	local := make(map[string]Exp, len(e.namespace))
+	for name, val := range e.namespace {
+		local[name] = val
+	}
+	return local
+}
+
+func (e *env) Parent() Env {
+	if e.parent == nil {
+		return nil
+	}
+	return e.parent
+}
+
 func (e *env) Protect() Env {
 	newNs := make(map[string]Exp, len(e.namespace))
 
@@ -0,0 +1,25 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEnv_UnboundName(t *testing.T) {
+	env := NewEnv(map[string]Exp{"x": NewNumber(1)}).Extend(nil)
+	if _, err := env.Get("x"); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err := env.Get("y")
+	var unbound *UnboundNameError
+	if !errors.As(err, &unbound) || unbound.Name != "y" {
+		t.Fatalf("expect unbound name y, but found %v", err)
+	}
+	if !errors.Is(err, ErrNameNotFound) {
+		t.Fatalf("expect name not found, but found %v", err)
+	}
+	if err := env.Set("y", NewNull()); !errors.Is(err, ErrNameNotFound) {
+		t.Fatalf("expect name not found, but found %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package engine
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -29,6 +30,71 @@ const (
 	CustomValue
 )
 
+var kindNames = [...]string{
+	NullValue:    "null",
+	BooleanValue: "boolean",
+	NumberValue:  "number",
+	StringValue:  "string",
+	ListValue:    "list",
+	MapValue:     "map",
+	SuspendValue: "suspended value",
+	MapExp:       "map expression",
+	ListExp:      "list expression",
+	ReducibleExp: "redex",
+	SuspendExp:   "suspended expression",
+	DelayedExp:   "delayed expression",
+	CustomValue:  "custom value",
+}
+
+// names of custom kinds, registered by interpreters defining them
+var customKindNames = make(map[Kind]string)
+
+// RegisterKindName names custom kind k in messages, it should be called in init, like RegisterBuiltinModule of kernel
+func RegisterKindName(k Kind, name string) {
+	customKindNames[k] = name
+}
+
+func (k Kind) String() string {
+	if name, ok := customKindNames[k]; ok {
+		return name
+	}
+	if k > CustomValue {
+		return fmt.Sprintf("custom value %d", k-CustomValue)
+	}
+	return kindNames[k]
+}
+
+// TypeError is an error of a value of unexpected kind
+type TypeError struct {
+	Expected Kind
+	Got      Exp
+	// sentinel error of the expected value, like ErrNotNumberValue, nil if none
+	Err error
+}
+
+func NewTypeError(expected Kind, got Exp, err error) *TypeError {
+	return &TypeError{
+		Expected: expected,
+		Got:      got,
+		Err:      err,
+	}
+}
+
+func (e *TypeError) Error() string {
+	found := "nothing"
+	if e.Got != nil {
+		found = e.Got.String()
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%s: found %s", e.Err.Error(), found)
+	}
+	return fmt.Sprintf("expect %s, but found %s", e.Expected.String(), found)
+}
+
+func (e *TypeError) Unwrap() error {
+	return e.Err
+}
+
 type Exp interface {
 	Kind() Kind
 	Equal(v Exp) bool
@@ -83,41 +149,12 @@ var ErrNotBooleanValue = errors.New("Not Boolean Value")
 
 func ToBoolean(v Exp) (bool, error) {
 	if v.Kind() != BooleanValue {
-		return false, ErrNotBooleanValue
+		return false, NewTypeError(BooleanValue, v, ErrNotBooleanValue)
 	}
 
 	return bool(v.(Boolean)), nil
 }
 
-// Number
-type Number float64
-
-func (n Number) Kind() Kind {
-	return NumberValue
-}
-
-func (n Number) Equal(v Exp) bool {
-	return v.Kind() == NumberValue && v.(Number) == n
-}
-
-func (n Number) String() string {
-	return fmt.Sprint(float64(n))
-}
-
-func NewNumber(n float64) Number {
-	return Number(n)
-}
-
-var ErrNotNumberValue = errors.New("Not Number Value")
-
-func ToNumber(v Exp) (float64, error) {
-	if v.Kind() != NumberValue {
-		return 0.0, ErrNotNumberValue
-	}
-
-	return float64(v.(Number)), nil
-}
-
 // String
 type String string
 
@@ -141,7 +178,7 @@ var ErrNotStringValue = errors.New("Not String Value")
 
 func ToString(v Exp) (string, error) {
 	if v.Kind() != StringValue {
-		return "", ErrNotStringValue
+		return "", NewTypeError(StringValue, v, ErrNotStringValue)
 	}
 	return string(v.(String)), nil
 }
@@ -159,12 +196,22 @@ func (m Map) Equal(v Exp) bool {
 
 func (m Map) String() string {
 	strs := make([]string, 0, len(m))
-	for name, val := range m {
-		strs = append(strs, fmt.Sprintf("%q: %s", name, val.String()))
+	for _, name := range SortedKeys(m) {
+		strs = append(strs, fmt.Sprintf("%q: %s", name, m[name].String()))
 	}
 	return fmt.Sprintf("{%s}", strings.Join(strs, ", "))
 }
 
+// SortedKeys gives keys of m in order, so that maps are printed deterministically
+func SortedKeys(m map[string]Exp) []string {
+	keys := make([]string, 0, len(m))
+	for name := range m {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func NewMap(m map[string]Exp) Map {
 	return Map(m)
 }
@@ -173,7 +220,7 @@ var ErrNotMapValue = errors.New("Not Map Value")
 
 func ToMap(v Exp) (map[string]Exp, error) {
 	if v.Kind() != MapValue {
-		return nil, ErrNotMapValue
+		return nil, NewTypeError(MapValue, v, ErrNotMapValue)
 	}
 
 	return v.(Map), nil
@@ -210,8 +257,8 @@ func (m MapEx) Equal(v Exp) bool {
 
 func (m MapEx) String() string {
 	strs := make([]string, 0, len(m))
-	for name, val := range m {
-		strs = append(strs, fmt.Sprintf("%q: %s", name, val.String()))
+	for _, name := range SortedKeys(m) {
+		strs = append(strs, fmt.Sprintf("%q: %s", name, m[name].String()))
 	}
 	return fmt.Sprintf("{%s}", strings.Join(strs, ", "))
 }
@@ -224,7 +271,7 @@ var ErrNotMapExp = errors.New("Not Map Exp")
 
 func ToMapExp(v Exp) (map[string]Exp, error) {
 	if v.Kind() != MapExp {
-		return nil, ErrNotMapExp
+		return nil, NewTypeError(MapExp, v, ErrNotMapExp)
 	}
 
 	return v.(MapEx), nil
@@ -257,7 +304,7 @@ var ErrNotListValue = errors.New("Not List Value")
 
 func ToList(v Exp) ([]Exp, error) {
 	if v.Kind() != ListValue {
-		return nil, ErrNotListValue
+		return nil, NewTypeError(ListValue, v, ErrNotListValue)
 	}
 
 	return v.(List), nil
@@ -304,7 +351,7 @@ var ErrNotListExp = errors.New("Not List Exp")
 
 func ToListExp(v Exp) ([]Exp, error) {
 	if v.Kind() != ListExp {
-		return nil, ErrNotListExp
+		return nil, NewTypeError(ListExp, v, ErrNotListExp)
 	}
 
 	return v.(ListEx), nil
@@ -333,7 +380,7 @@ var ErrNotSuspendValue = errors.New("Not Suspend Value")
 
 func ToSuspendValue(v Exp) (SuspendVal, error) {
 	if v.Kind() != SuspendValue {
-		return SuspendVal{}, ErrNotSuspendValue
+		return SuspendVal{}, NewTypeError(SuspendValue, v, ErrNotSuspendValue)
 	}
 
 	return v.(SuspendVal), nil
@@ -347,6 +394,8 @@ func UnsuspendValue(s SuspendVal) Redex {
 type Redex struct {
 	Name string
 	Exp  Exp
+	// source of parsed redex, nil if unknown, it is not compared
+	Span *Span
 }
 
 func (r Redex) Kind() Kind {
@@ -376,7 +425,7 @@ var ErrNotReducibleExp = errors.New("Not Reducible Exp")
 
 func ToRedex(v Exp) (Redex, error) {
 	if v.Kind() != ReducibleExp {
-		return Redex{}, ErrNotReducibleExp
+		return Redex{}, NewTypeError(ReducibleExp, v, ErrNotReducibleExp)
 	}
 
 	return v.(Redex), nil
@@ -413,7 +462,7 @@ var ErrNotDelayedExp = errors.New("Not Delayed Exp")
 
 func ToDelayedExp(v Exp) (DelayedEx, error) {
 	if v.Kind() != DelayedExp {
-		return DelayedEx{}, ErrNotDelayedExp
+		return DelayedEx{}, NewTypeError(DelayedExp, v, ErrNotDelayedExp)
 	}
 
 	return v.(DelayedEx), nil
@@ -442,7 +491,7 @@ var ErrNotSuspendExp = errors.New("Not Suspend Exp")
 
 func ToSuspendExp(v Exp) (SuspendEx, error) {
 	if v.Kind() != SuspendExp {
-		return SuspendEx{}, ErrNotSuspendExp
+		return SuspendEx{}, NewTypeError(SuspendExp, v, ErrNotSuspendExp)
 	}
 
 	return v.(SuspendEx), nil
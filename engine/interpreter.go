@@ -36,12 +36,29 @@ func (f RedexInterpreterFunc) RedexInterpret(ctx Context, interp Interpreter, ex
 	return f(ctx, interp, exp, env)
 }
 
+// DebugHook is called before each redex is reduced, the reduction fails with the error it returns
+type DebugHook interface {
+	BeforeReduce(ctx Context, exp Exp, env Env) error
+}
+
+type DebugHookFunc func(ctx Context, exp Exp, env Env) error
+
+func (f DebugHookFunc) BeforeReduce(ctx Context, exp Exp, env Env) error {
+	return f(ctx, exp, env)
+}
+
 type ExtensibleInterpreter interface {
 	Interpreter
 	RegisterInterpreter(name string, interpreter RedexInterpreter) RedexInterpreter
 	RegisterInfoExtracter(extracter InfoExtracter) InfoExtracter
 }
 
+// DebuggableInterpreter is implemented by interpreters that call a DebugHook
+type DebuggableInterpreter interface {
+	Interpreter
+	RegisterDebugHook(hook DebugHook) DebugHook
+}
+
 func Suspend(exp Exp, suspend bool) (Exp, error) {
 	switch exp.Kind() {
 	case DelayedExp:
@@ -145,20 +162,28 @@ type AbstractInterpreter struct {
 	redexInterpreters map[string]RedexInterpreter
 	extracter         InfoExtracter
 	redexEvaluator    RedexEvaluator
+	// nil if not debugging
+	debugHook DebugHook
 }
 
 func (interp *AbstractInterpreter) interpretMap(ctx Context, m Map, env Env) (Exp, bool, error) {
 	newM := make(map[string]Exp, len(m))
 	hasExpanded := false
-	for key, subExp := range m {
-		newExp, expanded, err := interp.interpret(ctx, subExp, env)
+	for _, key := range SortedKeys(m) {
+		newExp, expanded, err := interp.interpret(ctx, m[key], env)
 		if err != nil {
 			return nil, false, err
 		}
 		newM[key] = newExp
 		hasExpanded = hasExpanded || expanded
 	}
-	return NewMap(newM), hasExpanded, nil
+	result := NewMap(newM)
+	if meter := GetMeter(ctx); meter != nil {
+		if err := meter.Alloc(result); err != nil {
+			return nil, false, err
+		}
+	}
+	return result, hasExpanded, nil
 }
 
 func (interp *AbstractInterpreter) interpretList(ctx Context, l List, env Env) (Exp, bool, error) {
@@ -172,7 +197,13 @@ func (interp *AbstractInterpreter) interpretList(ctx Context, l List, env Env) (
 		newL[i] = newExp
 		hasExpanded = hasExpanded || expanded
 	}
-	return NewList(newL), hasExpanded, nil
+	result := NewList(newL)
+	if meter := GetMeter(ctx); meter != nil {
+		if err := meter.Alloc(result); err != nil {
+			return nil, false, err
+		}
+	}
+	return result, hasExpanded, nil
 }
 
 func (interp *AbstractInterpreter) interpretSuspendExp(ctx Context, s SuspendEx, env Env) (Exp, bool, error) {
@@ -191,8 +222,32 @@ func (interp *AbstractInterpreter) interpretSuspendExp(ctx Context, s SuspendEx,
 func (interp *AbstractInterpreter) interpret(ctx Context, exp Exp, env Env) (Exp, bool, error) {
 	e := exp
 	expanded := true
+	goCtx := GoContext(ctx)
+	meter := GetMeter(ctx)
+	if meter != nil {
+		if err := meter.Enter(); err != nil {
+			return nil, false, err
+		}
+		defer meter.Leave()
+	}
+	stack := GetCallStack(ctx)
+	base := 0
+	if stack != nil {
+		base = stack.Len()
+		defer stack.truncate(base)
+	}
 	for expanded {
 		glog.V(2).Infof("interpret %s", e)
+		if goCtx != nil {
+			if err := checkDone(goCtx); err != nil {
+				return nil, false, err
+			}
+		}
+		if meter != nil {
+			if err := meter.Step(); err != nil {
+				return nil, false, err
+			}
+		}
 		var interpErr error
 		switch e.Kind() {
 		case MapExp:
@@ -219,14 +274,36 @@ func (interp *AbstractInterpreter) interpret(ctx Context, exp Exp, env Env) (Exp
 				return nil, false, err
 			}
 			ctx, e, env = d.Context, d.Exp, d.Env
+			goCtx = GoContext(ctx)
+			if stack != nil {
+				stack.elide(base)
+			}
 			expanded, interpErr = true, nil
 		case ReducibleExp:
 			r, err := ToRedex(e)
 			if err != nil {
 				return nil, false, err
 			}
+			if interp.debugHook != nil {
+				if err := interp.debugHook.BeforeReduce(ctx, r, env); err != nil {
+					return nil, false, err
+				}
+			}
 			redexInterp := interp.redexInterpreters[r.Name]
+			var site *Span
+			if stack != nil {
+				site, stack.site = stack.site, r.Span
+			}
 			e, expanded, interpErr = interp.redexEvaluator.InterpretRedex(redexInterp, interp.interpret, ctx, r, env)
+			if interpErr != nil && r.Span != nil {
+				interpErr = locate(interpErr, *r.Span)
+			}
+			if stack != nil {
+				if interpErr != nil {
+					interpErr = trace(interpErr, stack)
+				}
+				stack.site = site
+			}
 		default:
 			// assume values
 			return e, false, nil
@@ -242,6 +319,9 @@ func (interp *AbstractInterpreter) interpret(ctx Context, exp Exp, env Env) (Exp
 }
 
 func (interp *AbstractInterpreter) Interpret(ctx Context, exp Exp, env Env) (Exp, error) {
+	if GetCallStack(ctx) == nil {
+		ctx, _ = WithCallStack(ctx)
+	}
 	newExp, _, err := interp.interpret(ctx, exp, env)
 	return newExp, err
 }
@@ -269,6 +349,13 @@ func (interp *AbstractInterpreter) RegisterInfoExtracter(extracter InfoExtracter
 	return oldExtracter
 }
 
+// RegisterDebugHook sets the hook called before each redex is reduced, nil removes it
+func (interp *AbstractInterpreter) RegisterDebugHook(hook DebugHook) DebugHook {
+	oldHook := interp.debugHook
+	interp.debugHook = hook
+	return oldHook
+}
+
 // Application Order
 func NewApplicationOrderInterpreter(fallback bool) ExtensibleInterpreter {
 	result := &ApplicationOrderInterpreter{
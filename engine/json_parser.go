@@ -1,9 +1,35 @@
 package engine
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 )
 
+// SyntaxError is an error of an ill-formed special form, like func or if
+type SyntaxError struct {
+	// name of the form, json if the source is not json
+	Form string
+	// span of the innermost enclosing array or object, nil if unknown
+	Span *Span
+	Msg  string
+}
+
+func NewSyntaxError(form string, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{
+		Form: form,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *SyntaxError) Error() string {
+	msg := fmt.Sprintf("invalid %s syntax: %s", e.Form, e.Msg)
+	if e.Span != nil {
+		return e.Span.String() + ": " + msg
+	}
+	return msg
+}
+
 type JsonStructRedexParser func(parser *JsonStructParser, name string, s interface{}) (Exp, error)
 
 type JsonStructParser struct {
@@ -12,6 +38,10 @@ type JsonStructParser struct {
 	DataRedexName      string
 	redexParsers       map[string]JsonStructRedexParser
 	defaultRedexParser JsonStructRedexParser
+	// spans of parsed json, nil if unknown
+	positions Positions
+	// spans of enclosing arrays and objects
+	spans []Span
 }
 
 func NewJsonStructParser(varRedex, applyRedex, dataRedex string) *JsonStructParser {
@@ -24,7 +54,48 @@ func NewJsonStructParser(varRedex, applyRedex, dataRedex string) *JsonStructPars
 	return parser
 }
 
+// WithPositions gives a parser of json read with positions, parsed redexes are located by them.
+// it shares registered redex parsers with parser.
+func (parser *JsonStructParser) WithPositions(positions Positions) *JsonStructParser {
+	p := *parser
+	p.positions = positions
+	p.spans = nil
+	return &p
+}
+
+// Locate sets the span of redex exp to the span of the innermost enclosing array or object, if not set.
+// redex parsers may locate redexes they make.
+func (parser *JsonStructParser) Locate(exp Exp) Exp {
+	r, ok := exp.(Redex)
+	if !ok || r.Span != nil || len(parser.spans) == 0 {
+		return exp
+	}
+	span := parser.spans[len(parser.spans)-1]
+	r.Span = &span
+	return r
+}
+
 func (parser *JsonStructParser) Parse(s interface{}) (Exp, error) {
+	if span, ok := parser.positions.Of(s); ok {
+		parser.spans = append(parser.spans, span)
+		defer func() {
+			parser.spans = parser.spans[:len(parser.spans)-1]
+		}()
+	}
+
+	exp, err := parser.parse(s)
+	if err != nil {
+		var serr *SyntaxError
+		if errors.As(err, &serr) && serr.Span == nil && len(parser.spans) != 0 {
+			span := parser.spans[len(parser.spans)-1]
+			serr.Span = &span
+		}
+		return nil, err
+	}
+	return parser.Locate(exp), nil
+}
+
+func (parser *JsonStructParser) parse(s interface{}) (Exp, error) {
 	if s == nil {
 		return NewNull(), nil
 	}
@@ -34,11 +105,13 @@ func (parser *JsonStructParser) Parse(s interface{}) (Exp, error) {
 		return NewBoolean(v), nil
 	case float64:
 		return NewNumber(v), nil
+	case json.Number:
+		return ParseNumber(string(v))
 	case string:
 		return NewRedex(parser.VarRedexName, NewString(v)), nil
 	case []interface{}:
 		if len(v) == 0 {
-			return nil, fmt.Errorf("invalid function application syntax: %v", v)
+			return nil, NewSyntaxError("function application", "%v", v)
 		}
 		exps, err := parser.ParseListExp(v)
 		if err != nil {
@@ -47,7 +120,7 @@ func (parser *JsonStructParser) Parse(s interface{}) (Exp, error) {
 		return NewRedex(parser.ApplyRedexName, NewListExp(exps)), nil
 	case map[string]interface{}:
 		if len(v) != 1 {
-			return nil, fmt.Errorf("invalid jsonp special syntax: %v", v)
+			return nil, NewSyntaxError("jsonp special", "%v", v)
 		}
 		for keyword, subExp := range v {
 			p := parser.redexParsers[keyword]
@@ -96,6 +169,8 @@ func (parser *JsonStructParser) ParseData(s interface{}) (Exp, error) {
 		return NewBoolean(v), nil
 	case float64:
 		return NewNumber(v), nil
+	case json.Number:
+		return ParseNumber(string(v))
 	case string:
 		return NewString(v), nil
 	case []interface{}:
@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// JsonReader reads json values like encoding/json does, into nil, bool, json.Number, string,
+// []interface{} and map[string]interface{}, and records the spans of arrays and objects.
+type JsonReader struct {
+	file      string
+	decoder   *json.Decoder
+	src       bytes.Buffer
+	lineStart []int64
+	scanned   int64
+	positions Positions
+}
+
+func NewJsonReader(r io.Reader, file string) *JsonReader {
+	reader := &JsonReader{
+		file:      file,
+		lineStart: []int64{0},
+		positions: make(Positions),
+	}
+	reader.decoder = json.NewDecoder(io.TeeReader(r, &reader.src))
+	reader.decoder.UseNumber()
+	return reader
+}
+
+// Positions are spans of arrays and objects, by their identities
+type Positions map[uintptr]Span
+
+func positionKey(s interface{}) (uintptr, bool) {
+	switch v := s.(type) {
+	case []interface{}:
+		if len(v) == 0 {
+			// empty slices may share their address
+			return 0, false
+		}
+		return reflect.ValueOf(v).Pointer(), true
+	case map[string]interface{}:
+		return reflect.ValueOf(v).Pointer(), true
+	default:
+		return 0, false
+	}
+}
+
+// Of gives the span of an array or object read by JsonReader
+func (p Positions) Of(s interface{}) (Span, bool) {
+	key, ok := positionKey(s)
+	if !ok || p == nil {
+		return Span{}, false
+	}
+	span, ok := p[key]
+	return span, ok
+}
+
+func (r *JsonReader) Positions() Positions {
+	return r.positions
+}
+
+// line and col of offset
+func (r *JsonReader) position(offset int64) (int, int) {
+	src := r.src.Bytes()
+	for ; r.scanned < offset && r.scanned < int64(len(src)); r.scanned++ {
+		if src[r.scanned] == '\n' {
+			r.lineStart = append(r.lineStart, r.scanned+1)
+		}
+	}
+	line := sort.Search(len(r.lineStart), func(i int) bool {
+		return r.lineStart[i] > offset
+	})
+	return line, int(offset-r.lineStart[line-1]) + 1
+}
+
+func (r *JsonReader) span(start, end int64) Span {
+	line, col := r.position(start)
+	endLine, endCol := r.position(end)
+	return Span{
+		File:    r.file,
+		Line:    line,
+		Col:     col,
+		EndLine: endLine,
+		EndCol:  endCol,
+	}
+}
+
+// Read reads the next value, io.EOF at the end of input
+func (r *JsonReader) Read() (interface{}, error) {
+	v, err := r.readValue()
+	if serr, ok := err.(*json.SyntaxError); ok {
+		line, col := r.position(serr.Offset)
+		return nil, &SyntaxError{
+			Form: "json",
+			Span: &Span{File: r.file, Line: line, Col: col},
+			Msg:  serr.Error(),
+		}
+	}
+	return v, err
+}
+
+func (r *JsonReader) readValue() (interface{}, error) {
+	tok, err := r.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	start := r.decoder.InputOffset() - 1
+
+	var v interface{}
+	switch delim {
+	case '[':
+		l := []interface{}{}
+		for r.decoder.More() {
+			sub, err := r.readValue()
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, sub)
+		}
+		v = l
+	case '{':
+		m := make(map[string]interface{})
+		for r.decoder.More() {
+			keyTok, err := r.decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			sub, err := r.readValue()
+			if err != nil {
+				return nil, err
+			}
+			m[keyTok.(string)] = sub
+		}
+		v = m
+	default:
+		return nil, fmt.Errorf("unexpected %s", delim.String())
+	}
+
+	// closing delimiter
+	if _, err := r.decoder.Token(); err != nil {
+		return nil, err
+	}
+	if key, ok := positionKey(v); ok {
+		r.positions[key] = r.span(start, r.decoder.InputOffset())
+	}
+	return v, nil
+}
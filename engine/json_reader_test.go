@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestJsonReader(t *testing.T) {
+	src := "[1,\n  {\"a\": [true, null]},\n  []] \"next\""
+	r := NewJsonReader(strings.NewReader(src), "f.json")
+
+	v, err := r.Read()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	l := v.([]interface{})
+	m := l[1].(map[string]interface{})
+	for s, expected := range map[string]interface{}{
+		"f.json:1:1": l,
+		"f.json:2:3": m,
+		"f.json:2:9": m["a"],
+	} {
+		span, ok := r.Positions().Of(expected)
+		if !ok || span.String() != s {
+			t.Fatalf("expect span %s, but found %v", s, span)
+		}
+	}
+	if span, _ := r.Positions().Of(l); span.EndLine != 3 || span.EndCol != 6 {
+		t.Fatalf("expect end at 3:6, but found %d:%d", span.EndLine, span.EndCol)
+	}
+	if _, ok := r.Positions().Of(l[2]); ok {
+		t.Fatal("expect no span of empty list")
+	}
+
+	v, err = r.Read()
+	if err != nil || v != "next" {
+		t.Fatalf("expect next, but found %v, %v", v, err)
+	}
+	if _, err = r.Read(); err != io.EOF {
+		t.Fatalf("expect EOF, but found %v", err)
+	}
+
+	_, err = NewJsonReader(strings.NewReader("[1,\n 2 3]"), "bad.json").Read()
+	if err == nil || !strings.HasPrefix(err.Error(), "bad.json:2:") {
+		t.Fatalf("expect located syntax error, but found %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// resource limits of an evaluation, zero limits are unlimited.
+// a meter counts the usage of an evaluation, it is given in context.
+
+const MeterKey = "meter"
+
+type Limits struct {
+	// reduction steps, each iteration of interpret is a step
+	MaxSteps int64
+	// nested interpret calls, tail calls are not nested
+	MaxDepth int
+	// runes of a string
+	MaxStringLength int
+	// elements of a list
+	MaxListLength int
+	// entries of a map
+	MaxMapSize int
+	// total size of created strings, lists, maps and numbers, in runes, elements, entries and digits.
+	// numbers fitting in a machine word are not counted
+	MaxAlloc int64
+}
+
+type Usage struct {
+	Steps int64
+	// deepest nesting reached
+	MaxDepth int
+	Alloc    int64
+}
+
+func (u Usage) String() string {
+	return fmt.Sprintf("steps: %d, depth: %d, alloc: %d", u.Steps, u.MaxDepth, u.Alloc)
+}
+
+// LimitError is returned when evaluation exceeds a limit
+type LimitError struct {
+	// name of the exceeded limit, like "steps"
+	Limit string
+	Max   int64
+	Usage Usage
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded: max is %d, usage is %s", e.Limit, e.Max, e.Usage.String())
+}
+
+type Meter struct {
+	limits Limits
+	usage  Usage
+	depth  int
+}
+
+func NewMeter(limits Limits) *Meter {
+	return &Meter{limits: limits}
+}
+
+func (m *Meter) Limits() Limits {
+	return m.limits
+}
+
+func (m *Meter) Usage() Usage {
+	return m.usage
+}
+
+func (m *Meter) exceeded(limit string, max int64) error {
+	return &LimitError{
+		Limit: limit,
+		Max:   max,
+		Usage: m.usage,
+	}
+}
+
+// Step counts a reduction step
+func (m *Meter) Step() error {
+	m.usage.Steps++
+	if m.limits.MaxSteps > 0 && m.usage.Steps > m.limits.MaxSteps {
+		return m.exceeded("steps", m.limits.MaxSteps)
+	}
+	return nil
+}
+
+// Enter counts a nested interpret call, it should be paired with Leave
+func (m *Meter) Enter() error {
+	m.depth++
+	if m.depth > m.usage.MaxDepth {
+		m.usage.MaxDepth = m.depth
+	}
+	if m.limits.MaxDepth > 0 && m.depth > m.limits.MaxDepth {
+		return m.exceeded("depth", int64(m.limits.MaxDepth))
+	}
+	return nil
+}
+
+func (m *Meter) Leave() {
+	m.depth--
+}
+
+// Alloc checks the size of a created value, and counts it in the allocation budget.
+// only the top level of v is counted, its elements are counted when they are created.
+func (m *Meter) Alloc(v Exp) error {
+	switch val := v.(type) {
+	case String:
+		return m.Reserve(StringValue, int64(utf8.RuneCountInString(string(val))))
+	case List:
+		return m.Reserve(ListValue, int64(len(val)))
+	case Map:
+		return m.Reserve(MapValue, int64(len(val)))
+	case Numeric:
+		return m.Reserve(NumberValue, NumberDigits(val))
+	default:
+		return nil
+	}
+}
+
+// Reserve checks the size of a value of kind before it is created, and counts it in the allocation budget,
+// so that primitives fail before building values beyond the limits.
+// size is in runes of strings, elements of lists, entries of maps or digits of numbers.
+func (m *Meter) Reserve(kind Kind, size int64) error {
+	switch kind {
+	case StringValue:
+		if m.limits.MaxStringLength > 0 && size > int64(m.limits.MaxStringLength) {
+			return m.exceeded("string length", int64(m.limits.MaxStringLength))
+		}
+	case ListValue:
+		if m.limits.MaxListLength > 0 && size > int64(m.limits.MaxListLength) {
+			return m.exceeded("list length", int64(m.limits.MaxListLength))
+		}
+	case MapValue:
+		if m.limits.MaxMapSize > 0 && size > int64(m.limits.MaxMapSize) {
+			return m.exceeded("map size", int64(m.limits.MaxMapSize))
+		}
+	}
+
+	m.usage.Alloc += size
+	if m.limits.MaxAlloc > 0 && m.usage.Alloc > m.limits.MaxAlloc {
+		return m.exceeded("alloc", m.limits.MaxAlloc)
+	}
+	return nil
+}
+
+// WithLimits makes a child context, evaluation in which is limited by limits
+func WithLimits(ctx Context, limits Limits) (Context, *Meter) {
+	m := NewMeter(limits)
+	return ctx.NewChild(map[string]interface{}{
+		MeterKey: m,
+	}), m
+}
+
+// GetMeter gives the meter of ctx, nil if evaluation is unlimited
+func GetMeter(ctx Context) *Meter {
+	v := ctx.Get(MeterKey)
+	if v == nil {
+		return nil
+	}
+	return v.(*Meter)
+}
+
+func IsLimitExceeded(err error) bool {
+	var limitErr *LimitError
+	return errors.As(err, &limitErr)
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMeter(t *testing.T) {
+	m := NewMeter(Limits{MaxSteps: 2, MaxDepth: 1, MaxStringLength: 3, MaxAlloc: 5})
+
+	if err := m.Step(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := m.Step(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := m.Step(); !IsLimitExceeded(err) {
+		t.Fatalf("expect steps limit error, but found %v", err)
+	}
+
+	if err := m.Enter(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := m.Enter(); !IsLimitExceeded(err) {
+		t.Fatalf("expect depth limit error, but found %v", err)
+	}
+	m.Leave()
+	m.Leave()
+
+	if err := m.Alloc(NewString("世界!")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := m.Alloc(NewString("abcd")); !IsLimitExceeded(err) {
+		t.Fatalf("expect string length limit error, but found %v", err)
+	}
+	if err := m.Alloc(NewInteger(1)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := m.Alloc(NewList([]Exp{NewNull(), NewNull(), NewNull()})); !IsLimitExceeded(err) {
+		t.Fatalf("expect alloc limit error, but found %v", err)
+	}
+
+	expected := Usage{Steps: 3, MaxDepth: 2, Alloc: 6}
+	if m.Usage() != expected {
+		t.Fatalf("expect %s, but found %s", expected.String(), m.Usage().String())
+	}
+}
+
+func TestNumberDigits(t *testing.T) {
+	huge := mustParseNumber("1" + strings.Repeat("0", 100))
+	if n := NumberDigits(huge); n < 100 || n > 102 {
+		t.Fatalf("expect about 101 digits, but found %d", n)
+	}
+	// word sized numbers are free like other scalars
+	if n := NumberDigits(NewInteger(-1)); n != 0 {
+		t.Fatalf("expect 0 digits, but found %d", n)
+	}
+	if n := MulDigits(huge, huge); n < 200 || n > 203 {
+		t.Fatalf("expect about 201 digits, but found %d", n)
+	}
+	if n := PowDigits(NewInteger(10), NewInteger(1000)); n < 1000 || n > 1300 {
+		t.Fatalf("expect about 1000 digits, but found %d", n)
+	}
+}
@@ -0,0 +1,340 @@
+package engine
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"math/bits"
+)
+
+// exact math on the number tower
+// no operation gives NaN, it is an error instead, overflowed floats are infinite.
+
+var (
+	ErrNaNResult         = errors.New("NaN Result")
+	ErrNotFiniteNumber   = errors.New("Not Finite Number")
+	ErrExponentTooLarge  = errors.New("Exponent Too Large")
+	ErrNegativeShiftSize = errors.New("Negative Shift Size")
+)
+
+// exact powers and shifts beyond this are refused, as their results would not fit in memory
+const maxExactExponent = 1 << 20
+
+func checkFloat(f float64) (Exp, error) {
+	if math.IsNaN(f) {
+		return nil, ErrNaNResult
+	}
+	return NewFloat(f), nil
+}
+
+func IsInf(v Exp) bool {
+	n, err := ToNumeric(v)
+	return err == nil && n.Rank() == FloatRank && math.IsInf(n.Float64(), 0)
+}
+
+func IsNaN(v Exp) bool {
+	n, err := ToNumeric(v)
+	return err == nil && n.Rank() == FloatRank && math.IsNaN(n.Float64())
+}
+
+func AbsNumber(a Exp) (Exp, error) {
+	n, err := ToNumeric(a)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := n.(type) {
+	case Integer:
+		if v.Sign() >= 0 {
+			return v, nil
+		}
+		return NewBigInteger(new(big.Int).Neg(v.BigInt())), nil
+	case Decimal:
+		return Decimal{unscaled: new(big.Int).Abs(v.unscaled), scale: v.scale}, nil
+	case Rational:
+		return NewRational(new(big.Rat).Abs(v.r)), nil
+	default:
+		return NewFloat(math.Abs(n.Float64())), nil
+	}
+}
+
+func roundNumber(a Exp, mode RoundingMode) (Exp, error) {
+	n, err := ToNumeric(a)
+	if err != nil {
+		return nil, err
+	}
+	if i, ok := n.(Integer); ok {
+		return i, nil
+	}
+	if n.Rank() == FloatRank && math.IsInf(n.Float64(), 0) {
+		return nil, ErrNotFiniteNumber
+	}
+	return NewBigInteger(roundRat(toRat(n), 0, mode).unscaled), nil
+}
+
+// FloorNumber, CeilNumber, TruncNumber and RoundNumber give integers,
+// RoundNumber rounds half to even.
+func FloorNumber(a Exp) (Exp, error) {
+	return roundNumber(a, RoundFloor)
+}
+
+func CeilNumber(a Exp) (Exp, error) {
+	return roundNumber(a, RoundCeiling)
+}
+
+func TruncNumber(a Exp) (Exp, error) {
+	return roundNumber(a, RoundDown)
+}
+
+func RoundNumber(a Exp) (Exp, error) {
+	return roundNumber(a, RoundHalfEven)
+}
+
+// QuoNumber is the quotient truncated toward zero
+func QuoNumber(a, b Exp) (Exp, error) {
+	q, err := DivNumber(a, b)
+	if err != nil {
+		return nil, err
+	}
+	return TruncNumber(q)
+}
+
+// ModNumber is a - b * floor(a / b), it has the sign of b
+func ModNumber(a, b Exp) (Exp, error) {
+	q, err := DivNumber(a, b)
+	if err != nil {
+		return nil, err
+	}
+	q, err = FloorNumber(q)
+	if err != nil {
+		return nil, err
+	}
+	m, err := MulNumber(b, q)
+	if err != nil {
+		return nil, err
+	}
+	return SubNumber(a, m)
+}
+
+// PowNumber is exact for exact base and integer exponent, float otherwise,
+// decimals with negative exponent are rounded with DefaultDecimalContext.
+func PowNumber(a, b Exp) (Exp, error) {
+	return PowNumberWith(a, b, DefaultDecimalContext())
+}
+
+// PowNumberWith is PowNumber rounding decimals with ctx
+func PowNumberWith(a, b Exp, ctx DecimalContext) (Exp, error) {
+	n1, n2, _, err := toNumerics(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	e, ok := n2.(Integer)
+	if !ok || n1.Rank() == FloatRank {
+		return checkFloat(math.Pow(n1.Float64(), n2.Float64()))
+	}
+	exp, ok := e.Int64()
+	if !ok || exp > maxExactExponent || exp < -maxExactExponent {
+		return nil, ErrExponentTooLarge
+	}
+
+	neg := exp < 0
+	if neg {
+		if isZero(n1) {
+			return nil, ErrDivisionByZero
+		}
+		exp = -exp
+	}
+
+	var result Exp
+	switch v := n1.(type) {
+	case Integer:
+		result = NewBigInteger(new(big.Int).Exp(v.BigInt(), big.NewInt(exp), nil))
+	case Decimal:
+		if err := CheckDecimalScale(int64(v.scale) * exp); err != nil {
+			return nil, err
+		}
+		result = Decimal{
+			unscaled: new(big.Int).Exp(v.unscaled, big.NewInt(exp), nil),
+			scale:    v.scale * int32(exp),
+		}
+	default:
+		r := toRat(n1)
+		num := new(big.Int).Exp(r.Num(), big.NewInt(exp), nil)
+		den := new(big.Int).Exp(r.Denom(), big.NewInt(exp), nil)
+		result = NewRational(new(big.Rat).SetFrac(num, den))
+	}
+
+	if neg {
+		return DivNumberWith(NewInteger(1), result, ctx)
+	}
+	return result, nil
+}
+
+// SqrtNumber is exact for perfect squares of integers
+func SqrtNumber(a Exp) (Exp, error) {
+	n, err := ToNumeric(a)
+	if err != nil {
+		return nil, err
+	}
+	if c, _ := CompareNumber(n, NewInteger(0)); c < 0 {
+		return nil, ErrNaNResult
+	}
+
+	if i, ok := n.(Integer); ok {
+		bi := i.BigInt()
+		s := new(big.Int).Sqrt(bi)
+		if new(big.Int).Mul(s, s).Cmp(bi) == 0 {
+			return NewBigInteger(s), nil
+		}
+	}
+	return checkFloat(math.Sqrt(n.Float64()))
+}
+
+// bit operations on integers, negative integers are in two's complement
+
+func toIntegers(a, b Exp) (*big.Int, *big.Int, error) {
+	i1, err := ToInteger(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	i2, err := ToInteger(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return i1.BigInt(), i2.BigInt(), nil
+}
+
+func bitOp(op func(z, x, y *big.Int) *big.Int) func(a, b Exp) (Exp, error) {
+	return func(a, b Exp) (Exp, error) {
+		i1, i2, err := toIntegers(a, b)
+		if err != nil {
+			return nil, err
+		}
+		return NewBigInteger(op(new(big.Int), i1, i2)), nil
+	}
+}
+
+var (
+	BitAnd = bitOp((*big.Int).And)
+	BitOr  = bitOp((*big.Int).Or)
+	BitXor = bitOp((*big.Int).Xor)
+)
+
+func BitNot(a Exp) (Exp, error) {
+	i, err := ToInteger(a)
+	if err != nil {
+		return nil, err
+	}
+	return NewBigInteger(new(big.Int).Not(i.BigInt())), nil
+}
+
+func shiftSize(b Exp) (uint, error) {
+	i, err := ToInteger(b)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := i.Int64()
+	if !ok || n > maxExactExponent {
+		return 0, ErrExponentTooLarge
+	}
+	if n < 0 {
+		return 0, ErrNegativeShiftSize
+	}
+	return uint(n), nil
+}
+
+func ShiftLeft(a, b Exp) (Exp, error) {
+	i, err := ToInteger(a)
+	if err != nil {
+		return nil, err
+	}
+	n, err := shiftSize(b)
+	if err != nil {
+		return nil, err
+	}
+	return NewBigInteger(new(big.Int).Lsh(i.BigInt(), n)), nil
+}
+
+// ShiftRight is arithmetic, it rounds toward negative infinity
+func ShiftRight(a, b Exp) (Exp, error) {
+	i, err := ToInteger(a)
+	if err != nil {
+		return nil, err
+	}
+	n, err := shiftSize(b)
+	if err != nil {
+		return nil, err
+	}
+	return NewBigInteger(new(big.Int).Rsh(i.BigInt(), n)), nil
+}
+
+// sizes of exact results, estimated before they are computed so that a meter can refuse them
+
+// bits of the exact parts of n, floats have none
+func exactBits(n Numeric) int64 {
+	switch v := n.(type) {
+	case Integer:
+		if v.big == nil {
+			u := uint64(v.small)
+			if v.small < 0 {
+				u = -u
+			}
+			return int64(bits.Len64(u))
+		}
+		return int64(v.big.BitLen())
+	case Decimal:
+		return int64(v.unscaled.BitLen())
+	case Rational:
+		return int64(v.r.Num().BitLen() + v.r.Denom().BitLen())
+	default:
+		return 0
+	}
+}
+
+// bitDigits gives the decimal digits of a number of bits, numbers fitting in a word count none like other scalars
+func bitDigits(n int64) int64 {
+	if n < 64 {
+		return 0
+	}
+	// log10(2) is about 0.30103
+	return n/100000*30103 + n%100000*30103/100000 + 1
+}
+
+// NumberDigits gives the decimal digits a number is charged for by a meter
+func NumberDigits(n Numeric) int64 {
+	return bitDigits(exactBits(n))
+}
+
+// MulDigits estimates the decimal digits of MulNumber(a, b), zero if they are not numbers
+func MulDigits(a, b Exp) int64 {
+	n1, n2, _, err := toNumerics(a, b)
+	if err != nil {
+		return 0
+	}
+	return bitDigits(exactBits(n1) + exactBits(n2))
+}
+
+// PowDigits estimates the decimal digits of PowNumber(a, b), zero if they are not numbers or the power is refused
+func PowDigits(a, b Exp) int64 {
+	n1, n2, _, err := toNumerics(a, b)
+	if err != nil {
+		return 0
+	}
+	e, ok := n2.(Integer)
+	if !ok {
+		return 0
+	}
+	exp, ok := e.Int64()
+	if !ok || exp > maxExactExponent || exp < -maxExactExponent {
+		return 0
+	}
+	if exp < 0 {
+		exp = -exp
+	}
+	b1 := exactBits(n1)
+	if exp != 0 && b1 > math.MaxInt64/exp {
+		return math.MaxInt64
+	}
+	return bitDigits(b1 * exp)
+}
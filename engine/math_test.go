@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMathRounding(t *testing.T) {
+	cases := []struct {
+		f        func(Exp) (Exp, error)
+		value    Exp
+		expected string
+	}{
+		{FloorNumber, NewFloat(-1.5), "-2"},
+		{CeilNumber, NewFloat(-1.5), "-1"},
+		{TruncNumber, NewFloat(-1.5), "-1"},
+		{RoundNumber, NewFloat(-1.5), "-2"},
+		{RoundNumber, mustParseDecimal("0.5"), "0"},
+		{FloorNumber, mustParseNumber("123456789012345678901234567890"), "123456789012345678901234567890"},
+		{AbsNumber, mustParseDecimal("-1.50"), "1.50"},
+	}
+	for _, c := range cases {
+		n, err := c.f(c.value)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if n.String() != c.expected {
+			t.Fatalf("%s: expect %s, but found %s", c.value.String(), c.expected, n.String())
+		}
+	}
+
+	if _, err := FloorNumber(NewFloat(math.Inf(1))); err != ErrNotFiniteNumber {
+		t.Fatal("expect not finite number")
+	}
+}
+
+func TestMathDivision(t *testing.T) {
+	cases := []struct {
+		f        func(Exp, Exp) (Exp, error)
+		a, b     Exp
+		expected string
+	}{
+		{QuoNumber, NewInteger(7), NewInteger(-2), "-3"},
+		{ModNumber, NewInteger(7), NewInteger(-2), "-1"},
+		{ModNumber, NewInteger(-7), NewInteger(2), "1"},
+		{ModNumber, mustParseDecimal("5.5"), NewInteger(2), "1.5"},
+		{PowNumber, NewInteger(3), NewInteger(40), "12157665459056928801"},
+		{PowNumber, mustParseDecimal("1.1"), NewInteger(2), "1.21"},
+		{PowNumber, NewFloat(4), NewFloat(0.5), "2"},
+		{BitAnd, NewInteger(12), NewInteger(10), "8"},
+		{ShiftRight, NewInteger(-5), NewInteger(1), "-3"},
+	}
+	for _, c := range cases {
+		n, err := c.f(c.a, c.b)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if n.String() != c.expected {
+			t.Fatalf("%s, %s: expect %s, but found %s", c.a.String(), c.b.String(), c.expected, n.String())
+		}
+	}
+
+	if _, err := ModNumber(NewFloat(1), NewFloat(0)); err != ErrDivisionByZero {
+		t.Fatal("expect division by zero")
+	}
+	if _, err := PowNumber(NewInteger(0), NewInteger(-1)); err != ErrDivisionByZero {
+		t.Fatal("expect division by zero")
+	}
+	if _, err := PowNumber(NewFloat(-8), NewFloat(1.0/3)); err != ErrNaNResult {
+		t.Fatal("expect NaN result")
+	}
+	if _, err := PowNumber(NewInteger(2), NewInteger(1<<40)); err != ErrExponentTooLarge {
+		t.Fatal("expect exponent too large")
+	}
+
+	inf := NewFloat(math.Inf(1))
+	if _, err := SubNumber(inf, inf); err != ErrNaNResult {
+		t.Fatal("expect NaN result")
+	}
+	if n, _ := SqrtNumber(NewInteger(1 << 40)); n.String() != "1048576" {
+		t.Fatalf("expect exact square root, but found %s", n.String())
+	}
+}
@@ -0,0 +1,490 @@
+package engine
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Number tower: Integer < Decimal < Rational < Float
+// all of them are of NumberValue kind, and compare by numeric value.
+
+type NumberRank uint8
+
+const (
+	IntegerRank NumberRank = iota
+	DecimalRank
+	RationalRank
+	FloatRank
+)
+
+type Numeric interface {
+	Exp
+	Rank() NumberRank
+	Float64() float64
+}
+
+var (
+	ErrNotNumberValue = errors.New("Not Number Value")
+	ErrDivisionByZero = errors.New("Division By Zero")
+	ErrInvalidNumber  = errors.New("Invalid Number")
+)
+
+func ToNumeric(v Exp) (Numeric, error) {
+	n, ok := v.(Numeric)
+	if !ok || v.Kind() != NumberValue {
+		return nil, NewTypeError(NumberValue, v, ErrNotNumberValue)
+	}
+	return n, nil
+}
+
+// ToNumber converts any number into float64, which may lose precision
+func ToNumber(v Exp) (float64, error) {
+	n, err := ToNumeric(v)
+	if err != nil {
+		return 0.0, err
+	}
+	return n.Float64(), nil
+}
+
+func equalNumber(n Numeric, v Exp) bool {
+	if v.Kind() != NumberValue {
+		return false
+	}
+	c, err := CompareNumber(n, v)
+	return err == nil && c == 0
+}
+
+// Float
+type Number float64
+
+type Float = Number
+
+func (n Number) Kind() Kind {
+	return NumberValue
+}
+
+func (n Number) Equal(v Exp) bool {
+	return equalNumber(n, v)
+}
+
+// non-finite floats are not valid json numbers, they are printed as null
+func (n Number) String() string {
+	f := float64(n)
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "null"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func (n Number) Rank() NumberRank {
+	return FloatRank
+}
+
+func (n Number) Float64() float64 {
+	return float64(n)
+}
+
+func NewNumber(n float64) Number {
+	return Number(n)
+}
+
+func NewFloat(f float64) Float {
+	return Float(f)
+}
+
+// Integer, int64 if it fits, big.Int otherwise
+type Integer struct {
+	small int64
+	big   *big.Int
+}
+
+func (i Integer) Kind() Kind {
+	return NumberValue
+}
+
+func (i Integer) Equal(v Exp) bool {
+	return equalNumber(i, v)
+}
+
+func (i Integer) String() string {
+	if i.big != nil {
+		return i.big.String()
+	}
+	return strconv.FormatInt(i.small, 10)
+}
+
+func (i Integer) Rank() NumberRank {
+	return IntegerRank
+}
+
+func (i Integer) Float64() float64 {
+	if i.big != nil {
+		f, _ := new(big.Float).SetInt(i.big).Float64()
+		return f
+	}
+	return float64(i.small)
+}
+
+func (i Integer) Int64() (int64, bool) {
+	if i.big != nil {
+		return 0, false
+	}
+	return i.small, true
+}
+
+func (i Integer) BigInt() *big.Int {
+	if i.big != nil {
+		return new(big.Int).Set(i.big)
+	}
+	return big.NewInt(i.small)
+}
+
+func (i Integer) Sign() int {
+	if i.big != nil {
+		return i.big.Sign()
+	}
+	switch {
+	case i.small > 0:
+		return 1
+	case i.small < 0:
+		return -1
+	default:
+		return 0
+	}
+}
+
+func NewInteger(i int64) Integer {
+	return Integer{small: i}
+}
+
+func NewBigInteger(i *big.Int) Integer {
+	if i.IsInt64() {
+		return Integer{small: i.Int64()}
+	}
+	return Integer{big: new(big.Int).Set(i)}
+}
+
+var ErrNotIntegerValue = errors.New("Not Integer Value")
+
+func ToInteger(v Exp) (Integer, error) {
+	i, ok := v.(Integer)
+	if !ok {
+		return Integer{}, NewTypeError(NumberValue, v, ErrNotIntegerValue)
+	}
+	return i, nil
+}
+
+// Rational, never an integer
+type Rational struct {
+	r *big.Rat
+}
+
+func (r Rational) Kind() Kind {
+	return NumberValue
+}
+
+func (r Rational) Equal(v Exp) bool {
+	return equalNumber(r, v)
+}
+
+// terminating decimals are printed exactly, others are approximated
+func (r Rational) String() string {
+	if digits, ok := decimalDigits(r.r.Denom()); ok {
+		return r.r.FloatString(digits)
+	}
+	return NewFloat(r.Float64()).String()
+}
+
+func (r Rational) Rank() NumberRank {
+	return RationalRank
+}
+
+func (r Rational) Float64() float64 {
+	f, _ := r.r.Float64()
+	return f
+}
+
+func (r Rational) Rat() *big.Rat {
+	return new(big.Rat).Set(r.r)
+}
+
+// NewRational returns Integer if r is an integer
+func NewRational(r *big.Rat) Numeric {
+	if r.IsInt() {
+		return NewBigInteger(r.Num())
+	}
+	return Rational{r: new(big.Rat).Set(r)}
+}
+
+// number of fraction digits of 1/denom, if it terminates
+func decimalDigits(denom *big.Int) (int, bool) {
+	d := new(big.Int).Set(denom)
+	two, five := big.NewInt(2), big.NewInt(5)
+	m := new(big.Int)
+	twos, fives := 0, 0
+	for d.QuoRem(d, two, m); m.Sign() == 0; d.QuoRem(d, two, m) {
+		twos++
+	}
+	d.Mul(d, two).Add(d, m)
+	for d.QuoRem(d, five, m); m.Sign() == 0; d.QuoRem(d, five, m) {
+		fives++
+	}
+	d.Mul(d, five).Add(d, m)
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return 0, false
+	}
+	if twos > fives {
+		return twos, true
+	}
+	return fives, true
+}
+
+// parsing
+
+// ParseNumber parses json number literal exactly, integers are kept exact,
+// numbers with fraction or exponent are floats.
+func ParseNumber(s string) (Numeric, error) {
+	if s == "" {
+		return nil, ErrInvalidNumber
+	}
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return NewInteger(i), nil
+		}
+		i, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, ErrInvalidNumber
+		}
+		return NewBigInteger(i), nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, ErrInvalidNumber
+	}
+	return NewFloat(f), nil
+}
+
+// arithmetic
+
+func toRat(n Numeric) *big.Rat {
+	switch v := n.(type) {
+	case Integer:
+		if v.big != nil {
+			return new(big.Rat).SetInt(v.big)
+		}
+		return new(big.Rat).SetInt64(v.small)
+	case Decimal:
+		return v.Rat()
+	case Rational:
+		return v.r
+	default:
+		r := new(big.Rat).SetFloat64(n.Float64())
+		if r == nil {
+			return new(big.Rat)
+		}
+		return r
+	}
+}
+
+func toNumerics(a, b Exp) (Numeric, Numeric, NumberRank, error) {
+	n1, err := ToNumeric(a)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	n2, err := ToNumeric(b)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	rank := n1.Rank()
+	if n2.Rank() > rank {
+		rank = n2.Rank()
+	}
+	return n1, n2, rank, nil
+}
+
+type numberOp struct {
+	small   func(a, b int64) (int64, bool)
+	big     func(z, a, b *big.Int) *big.Int
+	decimal func(a, b Decimal) (Decimal, error)
+	rat     func(z, a, b *big.Rat) *big.Rat
+	float   func(a, b float64) float64
+}
+
+func (op numberOp) apply(a, b Exp) (Exp, error) {
+	n1, n2, rank, err := toNumerics(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	switch rank {
+	case IntegerRank:
+		i1, i2 := n1.(Integer), n2.(Integer)
+		if i1.big == nil && i2.big == nil {
+			if r, ok := op.small(i1.small, i2.small); ok {
+				return NewInteger(r), nil
+			}
+		}
+		return NewBigInteger(op.big(new(big.Int), i1.BigInt(), i2.BigInt())), nil
+	case DecimalRank:
+		return op.decimal(toDecimal(n1), toDecimal(n2))
+	case RationalRank:
+		return NewRational(op.rat(new(big.Rat), toRat(n1), toRat(n2))), nil
+	default:
+		return checkFloat(op.float(n1.Float64(), n2.Float64()))
+	}
+}
+
+var (
+	addOp = numberOp{
+		small: func(a, b int64) (int64, bool) {
+			r := a + b
+			return r, (r > a) == (b > 0)
+		},
+		big: (*big.Int).Add,
+		decimal: func(a, b Decimal) (Decimal, error) {
+			return decimalOp((*big.Int).Add, a, b), nil
+		},
+		rat:   (*big.Rat).Add,
+		float: func(a, b float64) float64 { return a + b },
+	}
+	subOp = numberOp{
+		small: func(a, b int64) (int64, bool) {
+			r := a - b
+			return r, (r < a) == (b > 0)
+		},
+		big: (*big.Int).Sub,
+		decimal: func(a, b Decimal) (Decimal, error) {
+			return decimalOp((*big.Int).Sub, a, b), nil
+		},
+		rat:   (*big.Rat).Sub,
+		float: func(a, b float64) float64 { return a - b },
+	}
+	mulOp = numberOp{
+		small: func(a, b int64) (int64, bool) {
+			if a == 0 || b == 0 {
+				return 0, true
+			}
+			r := a * b
+			if r/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+				return 0, false
+			}
+			return r, true
+		},
+		big:     (*big.Int).Mul,
+		decimal: decimalMul,
+		rat:     (*big.Rat).Mul,
+		float:   func(a, b float64) float64 { return a * b },
+	}
+)
+
+func AddNumber(a, b Exp) (Exp, error) {
+	return addOp.apply(a, b)
+}
+
+func SubNumber(a, b Exp) (Exp, error) {
+	return subOp.apply(a, b)
+}
+
+func MulNumber(a, b Exp) (Exp, error) {
+	return mulOp.apply(a, b)
+}
+
+func isZero(n Numeric) bool {
+	switch v := n.(type) {
+	case Integer:
+		return v.Sign() == 0
+	case Decimal:
+		return v.unscaled.Sign() == 0
+	case Rational:
+		return v.r.Sign() == 0
+	default:
+		return n.Float64() == 0
+	}
+}
+
+// DivNumber divides exactly, integers that are not divisible give a rational,
+// decimals are rounded with DefaultDecimalContext if the quotient does not terminate.
+func DivNumber(a, b Exp) (Exp, error) {
+	return DivNumberWith(a, b, DefaultDecimalContext())
+}
+
+// DivNumberWith is DivNumber rounding decimals with ctx
+func DivNumberWith(a, b Exp, ctx DecimalContext) (Exp, error) {
+	n1, n2, rank, err := toNumerics(a, b)
+	if err != nil {
+		return nil, err
+	}
+	if isZero(n2) {
+		return nil, ErrDivisionByZero
+	}
+
+	switch rank {
+	case IntegerRank:
+		i1, i2 := n1.(Integer), n2.(Integer)
+		if i1.big == nil && i2.big == nil && i1.small%i2.small == 0 &&
+			!(i1.small == math.MinInt64 && i2.small == -1) {
+			return NewInteger(i1.small / i2.small), nil
+		}
+		return NewRational(new(big.Rat).Quo(toRat(n1), toRat(n2))), nil
+	case DecimalRank:
+		return DivDecimal(n1, n2, ctx)
+	case RationalRank:
+		return NewRational(new(big.Rat).Quo(toRat(n1), toRat(n2))), nil
+	default:
+		return checkFloat(n1.Float64() / n2.Float64())
+	}
+}
+
+var ErrNaNNotComparable = errors.New("NaN Not Comparable")
+
+// CompareNumber compares numbers exactly, even between floats and big integers,
+// except that a float is compared with a decimal by its shortest representation,
+// so 0.1 equals decimal 0.1.
+func CompareNumber(a, b Exp) (int, error) {
+	n1, n2, rank, err := toNumerics(a, b)
+	if err != nil {
+		return 0, err
+	}
+
+	switch rank {
+	case IntegerRank:
+		i1, i2 := n1.(Integer), n2.(Integer)
+		if i1.big == nil && i2.big == nil {
+			switch {
+			case i1.small < i2.small:
+				return -1, nil
+			case i1.small > i2.small:
+				return 1, nil
+			default:
+				return 0, nil
+			}
+		}
+		return i1.BigInt().Cmp(i2.BigInt()), nil
+	case DecimalRank, RationalRank:
+		return toRat(n1).Cmp(toRat(n2)), nil
+	default:
+		f1, f2 := n1.Float64(), n2.Float64()
+		if math.IsNaN(f1) || math.IsNaN(f2) {
+			return 0, ErrNaNNotComparable
+		}
+		if math.IsInf(f1, 0) || math.IsInf(f2, 0) || (n1.Rank() == FloatRank && n2.Rank() == FloatRank) {
+			switch {
+			case f1 < f2:
+				return -1, nil
+			case f1 > f2:
+				return 1, nil
+			default:
+				return 0, nil
+			}
+		}
+		if n1.Rank() == DecimalRank || n2.Rank() == DecimalRank {
+			return toRat(toDecimal(n1)).Cmp(toRat(toDecimal(n2))), nil
+		}
+		return toRat(n1).Cmp(toRat(n2)), nil
+	}
+}
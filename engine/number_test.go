@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"testing"
+)
+
+func mustParseNumber(s string) Numeric {
+	n, err := ParseNumber(s)
+	if err != nil {
+		panic(err.Error())
+	}
+	return n
+}
+
+func TestParseNumber(t *testing.T) {
+	for _, s := range []string{"0", "-12", "9007199254740993", "123456789012345678901234567890", "1.5", "1e+100"} {
+		n := mustParseNumber(s)
+		if n.String() != s {
+			t.Fatalf("expect %s, but found %s", s, n.String())
+		}
+	}
+
+	if mustParseNumber("1").Rank() != IntegerRank || mustParseNumber("1.0").Rank() != FloatRank {
+		t.Fatal("unexpected number rank")
+	}
+}
+
+func TestNumberArithmetic(t *testing.T) {
+	// int64 overflow promotes to big integer
+	n, err := MulNumber(NewInteger(1<<62), NewInteger(4))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.String() != "18446744073709551616" {
+		t.Fatalf("expect 2^64, but found %s", n.String())
+	}
+
+	// exact division
+	n, err = DivNumber(NewInteger(1), NewInteger(4))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.String() != "0.25" {
+		t.Fatalf("expect 0.25, but found %s", n.String())
+	}
+	n, err = DivNumber(NewInteger(1), NewInteger(3))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	n, err = MulNumber(n, NewInteger(3))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !NewInteger(1).Equal(n) || n.(Numeric).Rank() != IntegerRank {
+		t.Fatalf("expect integer 1, but found %s", n.String())
+	}
+
+	// promote to float
+	n, err = AddNumber(NewInteger(1), NewFloat(0.5))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !NewFloat(1.5).Equal(n) {
+		t.Fatalf("expect 1.5, but found %s", n.String())
+	}
+
+	if _, err := DivNumber(NewInteger(1), NewInteger(0)); err != ErrDivisionByZero {
+		t.Fatalf("expect division by zero, but found %v", err)
+	}
+}
+
+func TestCompareNumber(t *testing.T) {
+	big1 := mustParseNumber("9007199254740993")
+	big2 := mustParseNumber("9007199254740992")
+	if big1.Equal(big2) {
+		t.Fatal("big integers should be exact")
+	}
+	if c, _ := CompareNumber(big1, NewFloat(9007199254740992)); c != 1 {
+		t.Fatal("expect 9007199254740993 > 9007199254740992.0")
+	}
+	if !NewInteger(3).Equal(NewFloat(3)) {
+		t.Fatal("expect 3 = 3.0")
+	}
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// source positions
+
+// Span is a range of source, lines and columns start at 1, columns count bytes, the end is exclusive
+type Span struct {
+	File    string
+	Line    int
+	Col     int
+	EndLine int
+	EndCol  int
+}
+
+// file:line:col of the start, file is omitted if unknown
+func (s Span) String() string {
+	if s.File == "" {
+		return fmt.Sprintf("%d:%d", s.Line, s.Col)
+	}
+	return fmt.Sprintf("%s:%d:%d", s.File, s.Line, s.Col)
+}
+
+// SpanOf gives the span of a parsed redex
+func SpanOf(exp Exp) (Span, bool) {
+	r, ok := exp.(Redex)
+	if !ok || r.Span == nil {
+		return Span{}, false
+	}
+	return *r.Span, true
+}
+
+// LocatedError is an error of reducing the redex at Span
+type LocatedError struct {
+	Span Span
+	Err  error
+}
+
+func (e *LocatedError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Span.String(), e.Err.Error())
+}
+
+func (e *LocatedError) Unwrap() error {
+	return e.Err
+}
+
+// locate wraps err with span, unless it is located already by an inner redex
+func locate(err error, span Span) error {
+	var located *LocatedError
+	if errors.As(err, &located) {
+		return err
+	}
+	return &LocatedError{Span: span, Err: err}
+}
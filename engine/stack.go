@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// call stacks
+
+const CallStackKey = "call-stack"
+
+// Frame is an active function call
+type Frame struct {
+	// name of the function, "func" if anonymous
+	Name string
+	// module of the function, empty at top level
+	Module string
+	// span of the calling redex, nil if unknown
+	Site *Span
+	// number of frames replaced by tail calls between this frame and its caller
+	Elided int
+}
+
+func (f Frame) String() string {
+	if f.Module == "" {
+		return f.Name
+	}
+	return f.Module + "." + f.Name
+}
+
+// CallStack holds the frames of an evaluation, innermost last
+type CallStack struct {
+	frames []Frame
+	// span of the redex being reduced
+	site *Span
+}
+
+// Push enters a frame, it is left by Pop or when the interpreter loop entered before returns
+func (s *CallStack) Push(f Frame) {
+	s.frames = append(s.frames, f)
+}
+
+func (s *CallStack) Pop() {
+	if len(s.frames) > 0 {
+		s.frames = s.frames[:len(s.frames)-1]
+	}
+}
+
+func (s *CallStack) Len() int {
+	return len(s.frames)
+}
+
+// Top gives the innermost frame, false if no function is called
+func (s *CallStack) Top() (Frame, bool) {
+	if len(s.frames) == 0 {
+		return Frame{}, false
+	}
+	return s.frames[len(s.frames)-1], true
+}
+
+// Frames gives a copy of the frames, innermost first
+func (s *CallStack) Frames() []Frame {
+	frames := make([]Frame, len(s.frames))
+	for i, f := range s.frames {
+		frames[len(frames)-1-i] = f
+	}
+	return frames
+}
+
+// Site gives the span of the redex being reduced, nil if unknown
+func (s *CallStack) Site() *Span {
+	return s.site
+}
+
+func (s *CallStack) truncate(n int) {
+	if n < len(s.frames) {
+		s.frames = s.frames[:n]
+	}
+}
+
+// a frame pushed above the running frame of a loop replaces it, as the call is a tail call
+func (s *CallStack) elide(base int) {
+	n := len(s.frames)
+	if n <= base+1 {
+		return
+	}
+	top := s.frames[n-1]
+	for _, f := range s.frames[base : n-1] {
+		top.Elided += f.Elided + 1
+	}
+	s.frames = append(s.frames[:base], top)
+}
+
+func GetCallStack(ctx Context) *CallStack {
+	v := ctx.Get(CallStackKey)
+	if v == nil {
+		return nil
+	}
+	return v.(*CallStack)
+}
+
+// WithCallStack gives a child context with an empty call stack
+func WithCallStack(ctx Context) (Context, *CallStack) {
+	stack := &CallStack{}
+	return ctx.NewChild(map[string]interface{}{
+		CallStackKey: stack,
+	}), stack
+}
+
+// StackError is an error carrying the call stack where it happened
+type StackError struct {
+	Err error
+	// innermost first
+	Frames []Frame
+}
+
+func (e *StackError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StackError) Unwrap() error {
+	return e.Err
+}
+
+// Trace prints the frames like a go panic trace, each frame with the position it is at
+func (e *StackError) Trace() string {
+	var at *Span
+	var located *LocatedError
+	if errors.As(e.Err, &located) {
+		at = &located.Span
+	}
+	return FormatTrace(e.Frames, at)
+}
+
+// FormatTrace prints frames, innermost first, like a go panic trace, the innermost frame is at at
+func FormatTrace(frames []Frame, at *Span) string {
+	var sb strings.Builder
+	for _, f := range frames {
+		writeFrame(&sb, f.String()+"(...)", at)
+		if f.Elided > 0 {
+			fmt.Fprintf(&sb, "\t... %d frames elided by tail calls ...\n", f.Elided)
+		}
+		at = f.Site
+	}
+	writeFrame(&sb, "top level", at)
+	return sb.String()
+}
+
+func writeFrame(sb *strings.Builder, name string, at *Span) {
+	sb.WriteString(name)
+	sb.WriteString("\n\t")
+	if at == nil {
+		sb.WriteString("?")
+	} else {
+		sb.WriteString(at.String())
+	}
+	sb.WriteString("\n")
+}
+
+// Format prints the trace after the message with %+v
+func (e *StackError) Format(f fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && f.Flag('+'):
+		fmt.Fprintf(f, "%s\n\n%s", e.Error(), e.Trace())
+	case verb == 'q':
+		fmt.Fprintf(f, "%q", e.Error())
+	default:
+		fmt.Fprint(f, e.Error())
+	}
+}
+
+// trace records the frames of stack in err, unless it is traced already by an inner redex or no function is called
+func trace(err error, stack *CallStack) error {
+	var traced *StackError
+	if stack.Len() == 0 || errors.As(err, &traced) {
+		return err
+	}
+	return &StackError{Err: err, Frames: stack.Frames()}
+}
+
+// ErrorTrace gives the trace of err, empty if it carries none
+func ErrorTrace(err error) string {
+	var traced *StackError
+	if !errors.As(err, &traced) {
+		return ""
+	}
+	return traced.Trace()
+}
@@ -0,0 +1,92 @@
+package kernel
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+// binding go functions by reflection
+
+var (
+	errorType       = reflect.TypeOf((*error)(nil)).Elem()
+	callContextType = reflect.TypeOf((*CallContext)(nil)).Elem()
+)
+
+// BindGoFunc makes a primitive of go function fn.
+// args are converted to parameter types, and results back into values, by engine.ToGoValue and engine.FromGoValue.
+// fn may take CallContext as the first parameter, and return an error as the last result.
+func BindGoFunc(name string, fn interface{}) (Exp, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return nil, fmt.Errorf("cannot bind %s: expect function, but found %T", name, fn)
+	}
+	t := v.Type()
+
+	withCall := t.NumIn() > 0 && t.In(0) == callContextType
+	firstArg := 0
+	if withCall {
+		firstArg = 1
+	}
+
+	numOut := t.NumOut()
+	withError := numOut > 0 && t.Out(numOut-1) == errorType
+	if withError {
+		numOut--
+	}
+	if numOut > 1 {
+		return nil, fmt.Errorf("cannot bind %s: too many results", name)
+	}
+
+	arity := ExactArity(t.NumIn() - firstArg)
+	if t.IsVariadic() {
+		arity = Arity{Min: t.NumIn() - firstArg - 1, Max: Variadic}
+	}
+
+	f := func(call CallContext, vals []Exp) (Exp, error) {
+		in := make([]reflect.Value, 0, len(vals)+firstArg)
+		if withCall {
+			in = append(in, reflect.ValueOf(&call).Elem())
+		}
+		for i, val := range vals {
+			var paramType reflect.Type
+			if t.IsVariadic() && i+firstArg >= t.NumIn()-1 {
+				paramType = t.In(t.NumIn() - 1).Elem()
+			} else {
+				paramType = t.In(i + firstArg)
+			}
+			arg, err := engine.ToGoValue(val, paramType)
+			if err != nil {
+				return nil, fmt.Errorf("%s: arg %d: %s", name, i+1, err.Error())
+			}
+			in = append(in, arg)
+		}
+
+		out := v.Call(in)
+		if withError && !out[len(out)-1].IsNil() {
+			return nil, out[len(out)-1].Interface().(error)
+		}
+		if numOut == 0 {
+			return engine.NewNull(), nil
+		}
+		result, err := engine.FromGoValue(out[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: result: %s", name, err.Error())
+		}
+		return result, nil
+	}
+
+	pri := NewVariadicCallPrimitive(arity, f).(PrimitiveFunc)
+	pri.Name = name
+	return pri, nil
+}
+
+// MustBindGoFunc is BindGoFunc, but panics on error
+func MustBindGoFunc(name string, fn interface{}) Exp {
+	pri, err := BindGoFunc(name, fn)
+	if err != nil {
+		panic(err.Error())
+	}
+	return pri
+}
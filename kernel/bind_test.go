@@ -0,0 +1,89 @@
+package kernel
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+type bindPoint struct {
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Label string `json:"label,omitempty"`
+}
+
+func init() {
+	RegisterBuiltinModule(NewBuiltinModule("test-bind", map[string]Exp{
+		"upper": MustBindGoFunc("upper", strings.ToUpper),
+		"div": MustBindGoFunc("div", func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("div by zero")
+			}
+			return a / b, nil
+		}),
+		"move": MustBindGoFunc("move", func(p bindPoint, dx, dy int) bindPoint {
+			return bindPoint{X: p.X + dx, Y: p.Y + dy}
+		}),
+		"sum": MustBindGoFunc("sum", func(xs ...float64) float64 {
+			total := 0.0
+			for _, x := range xs {
+				total += x
+			}
+			return total
+		}),
+		"count": MustBindGoFunc("count", func(m map[string][]string) int {
+			n := 0
+			for _, l := range m {
+				n += len(l)
+			}
+			return n
+		}),
+		"call": MustBindGoFunc("call", func(call CallContext, fn Exp, x int) (Exp, error) {
+			return call.Apply(fn, engine.NewInteger(int64(x)))
+		}),
+	}, nil))
+}
+
+func TestBindGoFunc(t *testing.T) {
+	withImports := func(src string) Exp {
+		return mustParse(`{"begin": [{"import": {"test-bind": ["upper", "div", "move", "sum", "count", "call"]}}, ` + src + `]}`)
+	}
+
+	tests := map[string]string{
+		`["upper", {"data": "abc"}]`: `"ABC"`,
+		`["div", 7, 2]`:              `3`,
+		`["move", {"data": {"x": 1, "y": 2, "label": "a"}}, 10, 20]`: `{"x": 11, "y": 22}`,
+		`["sum"]`:         `0`,
+		`["sum", 1, 2.5]`: `3.5`,
+		`["count", {"data": {"a": ["x", "y"], "b": ["z"]}}]`: `3`,
+		`["call", {"func": [["x"], ["*", "x", 2]]}, 21]`:     `42`,
+	}
+	for src, expected := range tests {
+		val, err := interp(withImports(src))
+		if err != nil {
+			t.Fatalf("%s: %s", src, err.Error())
+		}
+		if val.String() != expected {
+			t.Fatalf("%s: expect %s, but found %s", src, expected, val.String())
+		}
+	}
+
+	errors := map[string]string{
+		`["div", 1, 0]`:               "div by zero",
+		`["div", 1.5, 1]`:             "div: arg 1: cannot convert 1.5 to int",
+		`["upper", 1]`:                "upper: arg 1: cannot convert 1 to string",
+		`["upper", {"data": "a"}, 1]`: "invalid arity",
+	}
+	for src, expected := range errors {
+		_, err := interp(withImports(src))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("%s: expect error %q, but found %v", src, expected, err)
+		}
+	}
+
+	if _, err := BindGoFunc("bad", 42); err == nil {
+		t.Fatal("expect error binding non function")
+	}
+}
@@ -0,0 +1,88 @@
+package kernel
+
+import (
+	"fmt"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+// CallContext is given to call primitives, so that they can call back into the interpreter
+type CallContext interface {
+	Context() Context
+	Interpreter() Interpreter
+	// Apply applies any callable value, closures, primitives or casted functions
+	Apply(fn Exp, args ...Exp) (Exp, error)
+	// Get reads a context value
+	Get(key string) interface{}
+	// Errorf reports an error at the call site
+	Errorf(format string, args ...interface{}) error
+	// Reserve counts the result in the meter before it is created, the result is not counted again when returned.
+	// size is in runes of strings, elements of lists, entries of maps or digits of numbers.
+	Reserve(kind engine.Kind, size int64) error
+}
+
+// Apply applies a closure, primitive or casted function from go.
+// it is reentrant, go code called by primitives may apply functions with the context it is given.
+func Apply(ctx Context, interp Interpreter, fn Exp, args ...Exp) (Exp, error) {
+	if engine.GetCallStack(ctx) == nil {
+		ctx, _ = engine.WithCallStack(ctx)
+	}
+	return applyFunc(EnsureEvalLevel(ctx, ExprLevel), interp, fn, args)
+}
+
+type callContext struct {
+	ctx    Context
+	interp Interpreter
+	// call expression, nil if called from go
+	site Exp
+	// span of the call expression, nil if unknown
+	span *engine.Span
+	// the result is counted by Reserve
+	reserved bool
+}
+
+func newCallContext(ctx Context, interp Interpreter, site Exp) *callContext {
+	return &callContext{
+		ctx:    EnsureEvalLevel(ctx, ExprLevel),
+		interp: interp,
+		site:   site,
+		span:   callSite(ctx),
+	}
+}
+
+func (c *callContext) Context() Context {
+	return c.ctx
+}
+
+func (c *callContext) Interpreter() Interpreter {
+	return c.interp
+}
+
+func (c *callContext) Apply(fn Exp, args ...Exp) (Exp, error) {
+	return Apply(c.ctx, c.interp, fn, args...)
+}
+
+func (c *callContext) Get(key string) interface{} {
+	return c.ctx.Get(key)
+}
+
+// Errorf locates the error at the span of the call expression, or prints the expression if it has no span
+func (c *callContext) Errorf(format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	if c.site == nil {
+		return err
+	}
+	if c.span != nil {
+		return &engine.LocatedError{Span: *c.span, Err: err}
+	}
+	return fmt.Errorf("%s, in %s", err.Error(), c.site.String())
+}
+
+func (c *callContext) Reserve(kind engine.Kind, size int64) error {
+	c.reserved = true
+	meter := engine.GetMeter(c.ctx)
+	if meter == nil {
+		return nil
+	}
+	return meter.Reserve(kind, size)
+}
@@ -0,0 +1,108 @@
+package kernel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+func init() {
+	RegisterBuiltinModule(NewBuiltinModule("test-call", map[string]Exp{
+		"twice": NewCallPrimitive(2, func(call CallContext, vals []Exp) (Exp, error) {
+			val, err := call.Apply(vals[0], vals[1])
+			if err != nil {
+				return nil, err
+			}
+			return call.Apply(vals[0], val)
+		}),
+		"contracts?": NewCallPrimitive(0, func(call CallContext, vals []Exp) (Exp, error) {
+			return engine.NewBoolean(call.Get(ContractsKey).(bool)), nil
+		}),
+		"fail": NewCallPrimitive(1, func(call CallContext, vals []Exp) (Exp, error) {
+			return nil, call.Errorf("failed with %s", vals[0].String())
+		}),
+		// go code applying functions while evaluating
+		"apply-go": NewCallPrimitive(2, func(call CallContext, vals []Exp) (Exp, error) {
+			return Apply(call.Context(), call.Interpreter(), vals[0], vals[1])
+		}),
+	}, nil))
+}
+
+func TestCallContext(t *testing.T) {
+	withImports := func(src string) Exp {
+		return mustParse(`{"begin": [{"import": {"test-call": ["twice", "contracts?", "fail"]}}, ` + src + `]}`)
+	}
+
+	val, err := interp(withImports(`["twice", {"func": [["x"], ["*", "x", 3]]}, 2]`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "18" {
+		t.Fatalf("expect 18, but found %s", val.String())
+	}
+
+	_, err = interp(withImports(`["twice", "twice", 1]`))
+	if err == nil {
+		t.Fatal("expect arity error")
+	}
+
+	val, err = interp(withImports(`["contracts?"]`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "true" {
+		t.Fatalf("expect true, but found %s", val.String())
+	}
+
+	_, err = interp(withImports(`["fail", 42]`))
+	var located *engine.LocatedError
+	if !errors.As(err, &located) || located.Span.String() != "1:72" || located.Err.Error() != "failed with 42" {
+		t.Fatalf("expect error at call site, but found %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	fn, err := interp(mustParse(`{"func": [["x"], ["+", "x", 1]]}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	ctx := engine.NewContext(nil)
+	kernelInterp := NewKernelInterpreter()
+	val, err := Apply(ctx, kernelInterp, fn, engine.NewInteger(41))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "42" {
+		t.Fatalf("expect 42, but found %s", val.String())
+	}
+
+	plus := preludeModule.ExportValues["+"]
+	val, err = Apply(ctx, kernelInterp, plus, engine.NewInteger(1), engine.NewInteger(2), engine.NewInteger(3))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "6" {
+		t.Fatalf("expect 6, but found %s", val.String())
+	}
+
+	if _, err := Apply(ctx, kernelInterp, fn); err == nil {
+		t.Fatal("expect arity error")
+	}
+	if _, err := Apply(ctx, kernelInterp, engine.NewInteger(1)); err == nil {
+		t.Fatal("expect error applying a number")
+	}
+
+	// reentrant, closures applied from go are applying go functions
+	val, err = interp(mustParse(`{"begin": [
+		{"import": {"test-call": ["apply-go"]}},
+		["apply-go", {"func": [["x"], ["apply-go", {"func": [["y"], ["*", "y", 2]]}, "x"]]}, 21]
+	]}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "42" {
+		t.Fatalf("expect 42, but found %s", val.String())
+	}
+}
@@ -0,0 +1,154 @@
+package kernel
+
+import (
+	"fmt"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+// cast, checked at the boundary between typed and untyped modules
+
+type CastError struct {
+	Value Exp
+	Type  Type
+	// party providing the bad value
+	Blame string
+	// the other party
+	Other string
+}
+
+func (e *CastError) Error() string {
+	return fmt.Sprintf("cast failed at module boundary between %s and %s: expect %s, but found %s, blaming %s",
+		e.Blame, e.Other, e.Type.String(), e.Value.String(), e.Blame)
+}
+
+// castValue checks val against t, functions are wrapped to check later.
+// positive provides the value, negative receives it.
+func castValue(val Exp, t Type, positive, negative string) (Exp, error) {
+	fail := func() (Exp, error) {
+		return nil, &CastError{
+			Value: val,
+			Type:  t,
+			Blame: positive,
+			Other: negative,
+		}
+	}
+
+	switch t := t.(type) {
+	case AnyType:
+		return val, nil
+	case KindType:
+		if val.Kind() != t.Kind {
+			return fail()
+		}
+		return val, nil
+	case ListType:
+		l, err := engine.ToList(val)
+		if err != nil {
+			return fail()
+		}
+		newL := make([]Exp, len(l))
+		for i, sub := range l {
+			newL[i], err = castValue(sub, t.Elem, positive, negative)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return engine.NewList(newL), nil
+	case MapType:
+		m, err := engine.ToMap(val)
+		if err != nil {
+			return fail()
+		}
+		newM := make(map[string]Exp, len(m))
+		for name, sub := range m {
+			newM[name], err = castValue(sub, t.Elem, positive, negative)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return engine.NewMap(newM), nil
+	case RecordType:
+		m, err := engine.ToMap(val)
+		if err != nil {
+			return fail()
+		}
+		newM := make(map[string]Exp, len(m))
+		for name, sub := range m {
+			newM[name] = sub
+		}
+		for name, fieldType := range t.Fields {
+			sub, ok := m[name]
+			if !ok {
+				return fail()
+			}
+			newM[name], err = castValue(sub, fieldType, positive, negative)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return engine.NewMap(newM), nil
+	case FuncType:
+		// function should accept every args of t
+		arity, ok := funcArity(val)
+		if !ok || !arity.Accepts(len(t.Params)) || (t.Rest != nil && arity.Max != Variadic) {
+			return fail()
+		}
+		return NewCastedFunc(val, t, positive, negative), nil
+	default:
+		return fail()
+	}
+}
+
+func funcArity(fn Exp) (Arity, bool) {
+	switch fn.Kind() {
+	case PrimitiveFuncValue:
+		return fn.(PrimitiveFunc).Arity, true
+	case ClosureValue:
+		return ExactArity(len(fn.(Closure).Args)), true
+	case CastedFuncValue:
+		return fn.(CastedFunc).Type.Arity(), true
+	default:
+		return Arity{}, false
+	}
+}
+
+func applyCasted(ctx Context, interp Interpreter, c CastedFunc, args []Exp) (Exp, error) {
+	if !c.Type.Arity().Accepts(len(args)) {
+		return nil, arityError(c, "", len(args))
+	}
+
+	// arguments flow from the other party
+	castedArgs := make([]Exp, len(args))
+	for i, arg := range args {
+		casted, err := castValue(arg, c.Type.Param(i), c.Negative, c.Positive)
+		if err != nil {
+			return nil, err
+		}
+		castedArgs[i] = casted
+	}
+
+	val, err := applyFunc(ctx, interp, c.Func, castedArgs)
+	if err != nil {
+		return nil, err
+	}
+	return castValue(val, c.Type.Result, c.Positive, c.Negative)
+}
+
+func importTypes(importValues map[string]*ImportVal) map[string]Type {
+	types := make(map[string]Type, len(importValues))
+	for name, ival := range importValues {
+		if ival.Type != nil {
+			types[name] = ival.Type
+		}
+	}
+	return types
+}
+
+// values imported from a typed module into an untyped one are casted
+func castImport(val Exp, from *Module, t Type, to *Module) (Exp, error) {
+	if t == nil || !from.Typed || (to != nil && to.Typed) {
+		return val, nil
+	}
+	return castValue(val, t, moduleName(from), moduleName(to))
+}
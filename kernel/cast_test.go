@@ -0,0 +1,57 @@
+package kernel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+func TestCast_ModuleBoundary(t *testing.T) {
+	loader := &SimpleModuleLoader{
+		Modules: map[string]Exp{
+			"typed": mustNewModule("typed", `
+			{"def": {
+				"inc": {"func": [[["n", "number"]], {"returns": "number"}, ["+", "n", 1]]},
+				"twice": {"func": [[["f", {"func": [["number"], "number"]}], ["n", "number"]], {"returns": "number"},
+					["f", ["f", "n"]]]}
+			}}
+			{"export": ["inc", "twice"]}`),
+			"untyped": mustNewModule("untyped", `
+			{"import": {"typed": ["inc"]}}
+			["inc", {"data": "a"}]`),
+			"untyped2": mustNewModule("untyped2", `
+			{"import": {"typed": ["twice"]}}
+			["twice", {"func": [["n"], {"data": "a"}]}, 1]`),
+		},
+	}
+	repl := NewRepl(engine.ParserFunc(ParseJson), NewKernelInterpreter(), loader)
+
+	err := repl.EvalBatch("untyped")
+	var cerr *CastError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expect cast error, but found %v", err)
+	}
+	if cerr.Blame != "untyped" || cerr.Other != "typed" {
+		t.Fatalf("unexpected blame: %s", cerr.Error())
+	}
+
+	err = repl.EvalBatch("untyped2")
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expect cast error, but found %v", err)
+	}
+	if cerr.Blame != "untyped2" {
+		t.Fatalf("unexpected blame: %s", cerr.Error())
+	}
+
+	val, err := repl.EvalInteractive(mustParse(`{"begin": [
+		{"import": {"typed": ["twice", "inc"]}},
+		["twice", "inc", 1]
+	]}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !engine.NewNumber(3).Equal(val) {
+		t.Fatalf("expect 3, but found %s", val.String())
+	}
+}
@@ -0,0 +1,112 @@
+package kernel
+
+import (
+	"fmt"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+// contract
+
+const (
+	PreContract  = "pre"
+	PostContract = "post"
+	// return type annotation, in the same place as contracts
+	ReturnsClause = "returns"
+
+	// name of the return value, visible in post condition
+	ContractResultName = "result"
+
+	ContractsKey = "check-contracts"
+)
+
+// contracts are checked unless disabled in context
+func ContractsEnabled(ctx Context) bool {
+	v := ctx.Get(ContractsKey)
+	if v == nil {
+		return true
+	}
+	return v.(bool)
+}
+
+type ContractError struct {
+	// pre or post
+	Clause    string
+	Condition Exp
+	Caller    string
+	Callee    string
+}
+
+// pre condition failure blames the caller, post condition failure blames the callee
+func (e *ContractError) Blame() string {
+	if e.Clause == PreContract {
+		return e.Caller
+	}
+	return e.Callee
+}
+
+func (e *ContractError) Error() string {
+	return fmt.Sprintf("contract violation: %s condition %s failed, blaming %s (caller: %s, callee: %s)",
+		e.Clause, e.Condition.String(), e.Blame(), e.Caller, e.Callee)
+}
+
+func moduleName(m *Module) string {
+	if m == nil {
+		return "top level"
+	}
+	return m.Name
+}
+
+func checkContract(ctx Context, interp Interpreter, clause string, cond Exp, env Env, caller, callee *Module) error {
+	newCtx := EnsureEvalLevel(ctx, ExprLevel)
+	val, err := interp.Interpret(newCtx, cond, env)
+	if err != nil {
+		return err
+	}
+
+	ok, err := engine.ToBoolean(val)
+	if err != nil {
+		return fmt.Errorf("%s condition %s should be boolean, but found %s", clause, cond.String(), val.String())
+	}
+	if !ok {
+		return &ContractError{
+			Clause:    clause,
+			Condition: cond,
+			Caller:    moduleName(caller),
+			Callee:    moduleName(callee),
+		}
+	}
+	return nil
+}
+
+// checkPre checks the pre condition of clo called from ctx, in the context and env of its body
+func checkPre(ctx Context, interp Interpreter, clo Closure, bodyCtx Context, env Env) error {
+	if clo.Pre == nil {
+		return nil
+	}
+	return checkContract(bodyCtx, interp, PreContract, clo.Pre, env, GetCurrentModule(ctx), clo.Module)
+}
+
+// body of closure with post condition is evaluated eagerly, so it is not a tail call,
+// closures with only pre condition are applied by tail call.
+func applyContracted(ctx Context, interp Interpreter, clo Closure, bodyCtx Context, env Env) (Exp, error) {
+	if err := checkPre(ctx, interp, clo, bodyCtx, env); err != nil {
+		return nil, err
+	}
+
+	val, err := interp.Interpret(bodyCtx, clo.Body, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if clo.Post != nil {
+		postEnv := env.Extend(map[string]Exp{
+			ContractResultName: val,
+		})
+		if err := checkContract(bodyCtx, interp, PostContract, clo.Post, postEnv, GetCurrentModule(ctx), clo.Module); err != nil {
+			return nil, err
+		}
+	}
+
+	return val, nil
+}
@@ -0,0 +1,144 @@
+package kernel
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+// io module, streams are owned by the embedder and given in context
+
+const IOModuleName = "io"
+
+func init() {
+	RegisterBuiltinModule(newIOModule())
+}
+
+const (
+	StdoutKey = "stdout"
+	StderrKey = "stderr"
+	StdinKey  = "stdin"
+)
+
+// GetStdout gives the writer of program output, os.Stdout if not set
+func GetStdout(ctx Context) io.Writer {
+	v := ctx.Get(StdoutKey)
+	if v == nil {
+		return os.Stdout
+	}
+	return v.(io.Writer)
+}
+
+// GetStderr gives the writer of program errors, os.Stderr if not set
+func GetStderr(ctx Context) io.Writer {
+	v := ctx.Get(StderrKey)
+	if v == nil {
+		return os.Stderr
+	}
+	return v.(io.Writer)
+}
+
+// GetStdin gives the reader of program input, os.Stdin if not set
+func GetStdin(ctx Context) io.Reader {
+	v := ctx.Get(StdinKey)
+	if v == nil {
+		return os.Stdin
+	}
+	return v.(io.Reader)
+}
+
+// unbuffered, reads a byte at a time
+type byteReader struct {
+	io.Reader
+}
+
+func (r byteReader) ReadByte() (byte, error) {
+	var p [1]byte
+	for {
+		n, err := r.Read(p[:])
+		if n == 1 {
+			return p[0], nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readLine reads until newline, without reading ahead, so that r can be shared.
+// the line is returned without line ending, ok is false at the end of input.
+func readLine(r io.Reader) (line string, ok bool, err error) {
+	br, isByteReader := r.(io.ByteReader)
+	if !isByteReader {
+		br = byteReader{r}
+	}
+
+	var buf []byte
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			if len(buf) == 0 {
+				return "", false, nil
+			}
+			break
+		}
+		if err != nil {
+			return "", false, err
+		}
+		if b == '\n' {
+			break
+		}
+		buf = append(buf, b)
+	}
+	return strings.TrimSuffix(string(buf), "\r"), true, nil
+}
+
+// writePrimitive writes a value to the writer of context, shown by show
+func writePrimitive(getWriter func(Context) io.Writer, show func(Exp) string) Exp {
+	return WithCapability(IOCapability, NewCallPrimitive(1, func(call CallContext, vals []Exp) (Exp, error) {
+		if _, err := io.WriteString(getWriter(call.Context()), show(vals[0])); err != nil {
+			return nil, err
+		}
+		return engine.NewNull(), nil
+	}))
+}
+
+func displayLine(v Exp) string {
+	return displayString(v) + "\n"
+}
+
+func newIOModule() *Module {
+	values := map[string]Exp{
+		// a line of the value as the repl shows it, strings quoted
+		"print": writePrimitive(GetStdout, func(v Exp) string {
+			return v.String() + "\n"
+		}),
+		// a line of the value as to-string does, strings unquoted
+		"println": writePrimitive(GetStdout, displayLine),
+		// a line to stderr, as println
+		"eprint": writePrimitive(GetStderr, displayLine),
+		// a line of stdin, null at the end of input
+		"read-line": WithCapability(IOCapability, NewCallPrimitive(0, func(call CallContext, vals []Exp) (Exp, error) {
+			line, ok, err := readLine(GetStdin(call.Context()))
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return engine.NewNull(), nil
+			}
+			return engine.NewString(line), nil
+		})),
+	}
+
+	var writer = FuncType{Params: []Type{anyType}, Result: nullType}
+	types := map[string]Type{
+		"print":     writer,
+		"println":   writer,
+		"eprint":    writer,
+		"read-line": FuncType{Result: anyType},
+	}
+
+	return NewBuiltinModule(IOModuleName, values, types)
+}
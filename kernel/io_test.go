@@ -0,0 +1,59 @@
+package kernel
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+func TestIO(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	ctx := engine.NewContext(map[string]interface{}{
+		EvalLevelKey: TopLevel,
+		StdoutKey:    &stdout,
+		StderrKey:    &stderr,
+		StdinKey:     strings.NewReader("first\r\nsecond\nlast"),
+	})
+
+	exp := mustParse(`{"begin": [
+		{"import": {"io": ["print", "println", "eprint", "read-line"]}},
+		["print", {"data": "a"}],
+		["print", 1],
+		["println", {"data": [1, "b"]}],
+		["eprint", {"data": "oops"}],
+		["println", ["read-line"]],
+		["println", ["read-line"]],
+		["println", ["read-line"]],
+		["read-line"]
+	]}`)
+	val, err := EvalTopLevel(ctx, NewKernelInterpreter(), exp, make(map[string]Exp))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "null" {
+		t.Fatalf("expect null at end of input, but found %s", val.String())
+	}
+
+	if expected := "\"a\"\n1\n[1, \"b\"]\nfirst\nsecond\nlast\n"; stdout.String() != expected {
+		t.Fatalf("expect stdout %q, but found %q", expected, stdout.String())
+	}
+	if expected := "oops\n"; stderr.String() != expected {
+		t.Fatalf("expect stderr %q, but found %q", expected, stderr.String())
+	}
+}
+
+func TestReadLine_Shared(t *testing.T) {
+	// lines are read without reading ahead
+	r := strings.NewReader("one\ntwo\n")
+	line, ok, err := readLine(byteReader{r})
+	if err != nil || !ok || line != "one" {
+		t.Fatalf("expect one, but found %q, %v", line, err)
+	}
+	rest := make([]byte, 10)
+	n, _ := r.Read(rest)
+	if string(rest[:n]) != "two\n" {
+		t.Fatalf("expect rest two, but found %q", string(rest[:n]))
+	}
+}
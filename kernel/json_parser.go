@@ -8,13 +8,16 @@ import (
 	"github.com/crcc/jsonp/engine"
 )
 
+// ParseJson parses a json expression, redexes are located in file-name of ctx
 func ParseJson(ctx Context, r io.Reader) (Exp, error) {
-	var v interface{}
-	if err := json.NewDecoder(r).Decode(&v); err != nil {
+	fileName, _ := ctx.Get("file-name").(string)
+	reader := engine.NewJsonReader(r, fileName)
+	v, err := reader.Read()
+	if err != nil {
 		return nil, err
 	}
 
-	return ParseJsonStruct(v)
+	return jsonStructParser.WithPositions(reader.Positions()).Parse(v)
 }
 
 func ParseJsonModule(ctx Context, r io.Reader) (Exp, error) {
@@ -31,16 +34,17 @@ func ParseJsonModule(ctx Context, r io.Reader) (Exp, error) {
 		err error
 		l   []Exp
 	)
-	decoder := json.NewDecoder(r)
+	reader := engine.NewJsonReader(r, fileName)
+	parser := jsonStructParser.WithPositions(reader.Positions())
 
 	for err == nil {
 		var v interface{}
-		if err = decoder.Decode(&v); err != nil {
+		if v, err = reader.Read(); err != nil {
 			break
 		}
 
 		var exp Exp
-		exp, err = ParseJsonStruct(v)
+		exp, err = parser.Parse(v)
 		if err != nil {
 			return nil, err
 		}
@@ -69,6 +73,9 @@ func init() {
 	jsonStructParser.RegisterRedexParser("if", parseJsonStructIf)
 	jsonStructParser.RegisterRedexParser("import", parseJsonStructImport)
 	jsonStructParser.RegisterRedexParser("export", parseJsonStructExport)
+	jsonStructParser.RegisterRedexParser("the", parseJsonStructThe)
+	jsonStructParser.RegisterRedexParser("decimal", parseJsonStructDecimal)
+	jsonStructParser.RegisterRedexParser("regex", parseJsonStructRegex)
 }
 
 func ParseJsonStruct(s interface{}) (Exp, error) {
@@ -80,35 +87,48 @@ func parseJsonStructBody(parser *engine.JsonStructParser, l []interface{}) (Exp,
 	case 0:
 		return nil, fmt.Errorf("empty body")
 	case 1:
-		return ParseJsonStruct(l[0])
+		return parser.Parse(l[0])
 	default:
 		exps, err := parser.ParseListExp(l)
 		if err != nil {
 			return nil, err
 		}
-		return engine.NewRedex("begin", engine.NewListExp(exps)), nil
+		// implicit begin, located at the enclosing form
+		return parser.Locate(engine.NewRedex("begin", engine.NewListExp(exps))), nil
 	}
 }
 
 func parseJsonStructFunc(parser *engine.JsonStructParser, name string, s interface{}) (Exp, error) {
 	l, ok := s.([]interface{})
 	if !ok || len(l) < 2 {
-		return nil, fmt.Errorf("invalid func syntax: %v", s)
+		return nil, engine.NewSyntaxError("func", "%v", s)
 	}
 
 	args, ok := l[0].([]interface{})
 	if !ok {
-		return nil, fmt.Errorf("invalid func syntax: %v, expect [args body ...]", s)
+		return nil, engine.NewSyntaxError("func", "%v, expect [args body ...]", s)
+	}
+	clauses, body, err := parseJsonStructFuncClauses(parser, l[1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return nil, engine.NewSyntaxError("func", "%v, empty body", s)
 	}
-	body := l[1:]
 
 	argExps := make([]Exp, len(args))
 	for i, arg := range args {
-		s, ok := arg.(string)
-		if !ok {
-			return nil, fmt.Errorf("invalid func syntax: %v, not arg: %v", s, arg)
+		argExp, err := parseJsonStructArg(parser, arg)
+		if err != nil {
+			return nil, engine.NewSyntaxError("func", "%v, %s", s, err.Error())
+		}
+		// the result of post condition would shadow the arg
+		if _, ok := clauses[PostContract]; ok {
+			if name, _, _ := funcArg(argExp); name == ContractResultName {
+				return nil, engine.NewSyntaxError("func", "%v, arg %s is shadowed in post condition", s, ContractResultName)
+			}
 		}
-		argExps[i] = engine.NewString(s)
+		argExps[i] = argExp
 	}
 
 	bodyExp, err := parseJsonStructBody(parser, body)
@@ -116,15 +136,137 @@ func parseJsonStructFunc(parser *engine.JsonStructParser, name string, s interfa
 		return nil, err
 	}
 
-	return engine.NewRedex("func", engine.NewListExp([]Exp{
-		engine.NewListExp(argExps), bodyExp,
-	})), nil
+	funcExps := []Exp{engine.NewListExp(argExps), bodyExp}
+	if len(clauses) != 0 {
+		funcExps = append(funcExps, engine.NewMapExp(clauses))
+	}
+	return engine.NewRedex("func", engine.NewListExp(funcExps)), nil
+}
+
+/*
+"name" or ["name", type]
+*/
+func parseJsonStructArg(parser *engine.JsonStructParser, arg interface{}) (Exp, error) {
+	switch v := arg.(type) {
+	case string:
+		return engine.NewString(v), nil
+	case []interface{}:
+		if len(v) != 2 {
+			return nil, fmt.Errorf("expect [name type], but found %v", v)
+		}
+		name, ok := v[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("not arg: %v", v[0])
+		}
+		t, err := parser.ParseData(v[1])
+		if err != nil {
+			return nil, err
+		}
+		return engine.NewListExp([]Exp{engine.NewString(name), t}), nil
+	default:
+		return nil, fmt.Errorf("not arg: %v", arg)
+	}
+}
+
+/*
+{"func": [["n"], {"pre": [">=", "n", 0]}, {"post": [">=", "result", 1]}, {"returns": "number"}, body ...]}
+*/
+func parseJsonStructFuncClauses(parser *engine.JsonStructParser, l []interface{}) (map[string]Exp, []interface{}, error) {
+	clauses := make(map[string]Exp)
+	for len(l) > 0 {
+		m, ok := l[0].(map[string]interface{})
+		if !ok || len(m) != 1 {
+			break
+		}
+
+		var (
+			clause string
+			cond   interface{}
+		)
+		for clause, cond = range m {
+		}
+		if clause != PreContract && clause != PostContract && clause != ReturnsClause {
+			break
+		}
+		if _, ok := clauses[clause]; ok {
+			return nil, nil, engine.NewSyntaxError("func", "duplicated %s clause", clause)
+		}
+
+		var (
+			exp Exp
+			err error
+		)
+		if clause == ReturnsClause {
+			exp, err = parser.ParseData(cond)
+		} else {
+			exp, err = parser.Parse(cond)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		clauses[clause] = exp
+		l = l[1:]
+	}
+	return clauses, l, nil
+}
+
+/*
+{"the": [type, exp]}
+*/
+func parseJsonStructThe(parser *engine.JsonStructParser, name string, s interface{}) (Exp, error) {
+	l, ok := s.([]interface{})
+	if !ok || len(l) != 2 {
+		return nil, engine.NewSyntaxError("the", "%v, expect [type exp]", s)
+	}
+
+	t, err := parser.ParseData(l[0])
+	if err != nil {
+		return nil, err
+	}
+	exp, err := parser.Parse(l[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.NewRedex("the", engine.NewListExp([]Exp{t, exp})), nil
+}
+
+/*
+{"decimal": "0.1"} or {"decimal": 0.1}, parsed exactly into decimal value
+*/
+func parseJsonStructDecimal(parser *engine.JsonStructParser, name string, s interface{}) (Exp, error) {
+	var lit string
+	switch v := s.(type) {
+	case string:
+		lit = v
+	case json.Number:
+		lit = string(v)
+	default:
+		return nil, engine.NewSyntaxError("decimal", "%v, expect string or number", s)
+	}
+
+	d, err := engine.ParseDecimal(lit)
+	if err != nil {
+		return nil, engine.NewSyntaxError("decimal", "invalid literal %s", lit)
+	}
+	return d, nil
+}
+
+/*
+{"regex": "pattern"}, compiled once while parsing
+*/
+func parseJsonStructRegex(parser *engine.JsonStructParser, name string, s interface{}) (Exp, error) {
+	pattern, ok := s.(string)
+	if !ok {
+		return nil, engine.NewSyntaxError("regex", "%v, expect string", s)
+	}
+	return CompileRegex(pattern)
 }
 
 func parseJsonStructBegin(parser *engine.JsonStructParser, name string, s interface{}) (Exp, error) {
 	l, ok := s.([]interface{})
 	if !ok || len(l) == 0 {
-		return nil, fmt.Errorf("invalid begin syntax: %v", s)
+		return nil, engine.NewSyntaxError("begin", "%v", s)
 	}
 
 	exps, err := parser.ParseListExp(l)
@@ -138,7 +280,7 @@ func parseJsonStructBegin(parser *engine.JsonStructParser, name string, s interf
 func parseJsonStructBlock(parser *engine.JsonStructParser, name string, s interface{}) (Exp, error) {
 	l, ok := s.([]interface{})
 	if !ok || len(l) == 0 {
-		return nil, fmt.Errorf("invalid block syntax: %v", s)
+		return nil, engine.NewSyntaxError("block", "%v", s)
 	}
 
 	bodyExp, err := parseJsonStructBody(parser, l)
@@ -152,7 +294,7 @@ func parseJsonStructBlock(parser *engine.JsonStructParser, name string, s interf
 func parseJsonStructIf(parser *engine.JsonStructParser, name string, s interface{}) (Exp, error) {
 	l, ok := s.([]interface{})
 	if !ok || len(l) != 3 {
-		return nil, fmt.Errorf("invalid if syntax: %v", s)
+		return nil, engine.NewSyntaxError("if", "%v", s)
 	}
 
 	exps, err := parser.ParseListExp(l)
@@ -166,7 +308,7 @@ func parseJsonStructIf(parser *engine.JsonStructParser, name string, s interface
 func parseJsonStructDef(parser *engine.JsonStructParser, name string, s interface{}) (Exp, error) {
 	m, ok := s.(map[string]interface{})
 	if !ok || len(m) == 0 {
-		return nil, fmt.Errorf("invalid def syntax: %v", s)
+		return nil, engine.NewSyntaxError("def", "%v", s)
 	}
 
 	exps, err := parser.ParseMapExp(m)
@@ -180,7 +322,7 @@ func parseJsonStructDef(parser *engine.JsonStructParser, name string, s interfac
 func parseJsonStructSet(parser *engine.JsonStructParser, name string, s interface{}) (Exp, error) {
 	m, ok := s.(map[string]interface{})
 	if !ok || len(m) == 0 {
-		return nil, fmt.Errorf("invalid set syntax: %v", s)
+		return nil, engine.NewSyntaxError("set", "%v", s)
 	}
 
 	exps, err := parser.ParseMapExp(m)
@@ -197,14 +339,14 @@ func parseJsonStructSet(parser *engine.JsonStructParser, name string, s interfac
 func parseJsonStructImport(parser *engine.JsonStructParser, name string, s interface{}) (Exp, error) {
 	m, ok := s.(map[string]interface{})
 	if !ok {
-		return nil, fmt.Errorf(`invalid import syntax: %v, expect {"path": ["name", ["name2", "alias"]], "path2": ...}`, s)
+		return nil, engine.NewSyntaxError("import", `%v, expect {"path": ["name", ["name2", "alias"]], "path2": ...}`, s)
 	}
 
 	importMap := make(map[string]Exp, len(m))
 	for name, spec := range m {
 		ss, ok := spec.([]interface{})
 		if !ok {
-			return nil, fmt.Errorf(`invalid import syntax: %v, expect ["name", ["name2", "alias"], ...]`, spec)
+			return nil, engine.NewSyntaxError("import", `%v, expect ["name", ["name2", "alias"], ...]`, spec)
 		}
 		specExps := make([]Exp, len(ss))
 		for i, item := range ss {
@@ -214,15 +356,15 @@ func parseJsonStructImport(parser *engine.JsonStructParser, name string, s inter
 			case []interface{}:
 				name, ok := v[0].(string)
 				if !ok {
-					return nil, fmt.Errorf(`invalid import syntax: %v, expect "name"`, v[0])
+					return nil, engine.NewSyntaxError("import", `%v, expect "name"`, v[0])
 				}
 				alias, ok := v[1].(string)
 				if !ok {
-					return nil, fmt.Errorf(`invalid import syntax: %v, expect "alias"`, v[1])
+					return nil, engine.NewSyntaxError("import", `%v, expect "alias"`, v[1])
 				}
 				specExps[i] = engine.NewListExp([]Exp{engine.NewString(name), engine.NewString(alias), engine.NewBoolean(true)})
 			default:
-				return nil, fmt.Errorf(`invalid import syntax: %v, expect "name" or ["name2", "alias"]`, item)
+				return nil, engine.NewSyntaxError("import", `%v, expect "name" or ["name2", "alias"]`, item)
 			}
 		}
 		importMap[name] = engine.NewListExp(specExps)
@@ -237,7 +379,7 @@ func parseJsonStructImport(parser *engine.JsonStructParser, name string, s inter
 func parseJsonStructExport(parser *engine.JsonStructParser, name string, s interface{}) (Exp, error) {
 	l, ok := s.([]interface{})
 	if !ok {
-		return nil, fmt.Errorf(`invalid export syntax: %v, expect {"path": ["name", ["name2", "alias"]], "path2": ...}`, s)
+		return nil, engine.NewSyntaxError("export", `%v, expect {"path": ["name", ["name2", "alias"]], "path2": ...}`, s)
 	}
 
 	specExps := make([]Exp, len(l))
@@ -248,15 +390,15 @@ func parseJsonStructExport(parser *engine.JsonStructParser, name string, s inter
 		case []interface{}:
 			name, ok := v[0].(string)
 			if !ok {
-				return nil, fmt.Errorf(`invalid export syntax: %v, expect "name"`, v[0])
+				return nil, engine.NewSyntaxError("export", `%v, expect "name"`, v[0])
 			}
 			alias, ok := v[1].(string)
 			if !ok {
-				return nil, fmt.Errorf(`invalid export syntax: %v, expect "alias"`, v[1])
+				return nil, engine.NewSyntaxError("export", `%v, expect "alias"`, v[1])
 			}
 			specExps[i] = engine.NewListExp([]Exp{engine.NewString(name), engine.NewString(alias)})
 		default:
-			return nil, fmt.Errorf(`invalid export syntax: %v, expect "name" or ["name2", "alias"]`, item)
+			return nil, engine.NewSyntaxError("export", `%v, expect "name" or ["name2", "alias"]`, item)
 		}
 	}
 
@@ -1,6 +1,8 @@
 package kernel
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -174,3 +176,75 @@ func TestParse_LoopForever(t *testing.T) {
 		t.Fatalf("expect %s, but found %s", exp.String(), e.String())
 	}
 }
+
+func TestParseJson_Spans(t *testing.T) {
+	ctx := engine.NewContext(map[string]interface{}{
+		"file-name": "main.jsonp",
+	})
+	exp, err := ParseJson(ctx, strings.NewReader(`{"func": [["x"],
+	["print", "x"],
+	["+", "x", 1]]}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	span, ok := engine.SpanOf(exp)
+	if !ok || span.String() != "main.jsonp:1:1" {
+		t.Fatalf("expect func at main.jsonp:1:1, but found %v", span)
+	}
+
+	// implicit begin of body is located at func
+	funcBody, _ := engine.ToListExp(exp.(engine.Redex).Exp)
+	span, ok = engine.SpanOf(funcBody[1])
+	if !ok || span.String() != "main.jsonp:1:1" {
+		t.Fatalf("expect begin at main.jsonp:1:1, but found %v", span)
+	}
+	body, _ := engine.ToListExp(funcBody[1].(engine.Redex).Exp)
+	span, ok = engine.SpanOf(body[1])
+	if !ok || span.String() != "main.jsonp:3:2" {
+		t.Fatalf("expect apply at main.jsonp:3:2, but found %v", span)
+	}
+}
+
+func TestInterpret_LocatedError(t *testing.T) {
+	_, err := interp(mustParse(`{"begin": [
+		{"def": {"f": {"func": [["x"], ["+", "x", 1]]}}},
+		["f", 1],
+		["f", {"data": "a"}]
+	]}`))
+	var located *engine.LocatedError
+	if !errors.As(err, &located) {
+		t.Fatalf("expect located error, but found %v", err)
+	}
+	// innermost redex
+	if located.Span.String() != "2:34" {
+		t.Fatalf("expect error at 2:34, but found %s", located.Error())
+	}
+}
+
+func TestInterpret_StackTrace(t *testing.T) {
+	_, err := interp(mustParse(`{"begin": [
+		{"def": {"inner": {"func": [["x"], ["+", "x", 1]]}}},
+		{"def": {"outer": {"func": [["x"], ["+", 1, ["inner", "x"]]]}}},
+		{"def": {"loop": {"func": [["n", "x"], {"if": [["<=", "n", 0], ["outer", "x"], ["loop", ["-", "n", 1], "x"]]}]}}},
+		["loop", 3, {"data": "a"}]
+	]}`))
+	var traced *engine.StackError
+	if !errors.As(err, &traced) {
+		t.Fatalf("expect stack error, but found %v", err)
+	}
+	// loop is replaced by tail calls, inner is called by outer
+	if len(traced.Frames) != 2 || traced.Frames[0].Name != "inner" || traced.Frames[1].Name != "outer" {
+		t.Fatalf("expect frames inner and outer, but found %v", traced.Frames)
+	}
+	if traced.Frames[1].Elided != 4 {
+		t.Fatalf("expect 4 elided frames, but found %d", traced.Frames[1].Elided)
+	}
+	expected := "inner(...)\n\t2:38\nouter(...)\n\t3:47\n\t... 4 frames elided by tail calls ...\ntop level\n\t4:66\n"
+	if traced.Trace() != expected {
+		t.Fatalf("expect trace\n%s\nbut found\n%s", expected, traced.Trace())
+	}
+	if !strings.HasSuffix(fmt.Sprintf("%+v", err), expected) {
+		t.Fatalf("expect trace printed with %%+v, but found %+v", err)
+	}
+}
@@ -3,12 +3,14 @@ package kernel
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/crcc/jsonp/engine"
 )
 
 var (
 	ErrUninitializedValue = errors.New("Uninitialized Value")
+	ErrAmbiguousValue     = errors.New("Ambiguous Value")
 )
 
 // type Evaluator interface {
@@ -64,6 +66,7 @@ func NewKernelInterpreter() engine.Interpreter {
 	interp.RegisterInterpreter("module", engine.RedexInterpreterFunc(moduleRedexInterpret))
 	interp.RegisterInterpreter("import", engine.RedexInterpreterFunc(importRedexInterpret))
 	interp.RegisterInterpreter("export", engine.RedexInterpreterFunc(exportRedexInterpret))
+	interp.RegisterInterpreter("the", engine.RedexInterpreterFunc(theRedexInterpret))
 	return interp
 }
 
@@ -84,6 +87,9 @@ func varRedexInterpret(ctx Context, intrep Interpreter, exp Exp, env Env) (Exp,
 	if IsUninitializedValue(val) {
 		return nil, ErrUninitializedValue
 	}
+	if IsAmbiguousValue(val) {
+		return nil, fmt.Errorf("%w: %q", ErrAmbiguousValue, varName)
+	}
 
 	return val, nil
 }
@@ -104,8 +110,8 @@ func funcRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp,
 		return nil, err
 	}
 
-	if len(l) != 2 {
-		return nil, errors.New("expect [args, body]")
+	if len(l) != 2 && len(l) != 3 {
+		return nil, engine.NewSyntaxError("func", "expect [args, body] or [args, body, contracts]")
 	}
 
 	argExps, err := engine.ToListExp(l[0])
@@ -114,16 +120,27 @@ func funcRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp,
 	}
 	body := l[1]
 
+	clo := NewClosure(nil, body, env)
+	clo.Module = GetCurrentModule(ctx)
+	if len(l) == 3 {
+		contracts, err := engine.ToMapExp(l[2])
+		if err != nil {
+			return nil, err
+		}
+		clo.Pre = contracts[PreContract]
+		clo.Post = contracts[PostContract]
+	}
+
 	// 0 args
 	if len(argExps) == 0 {
-		return NewClosure(nil, body, env), nil
+		return clo, nil
 	}
 
 	// convert args
 	args := make([]string, len(argExps))
 	dupM := make(map[string]struct{}, len(argExps))
 	for i, subExp := range argExps {
-		arg, err := engine.ToString(subExp)
+		arg, _, err := funcArg(subExp)
 		if err != nil {
 			return nil, err
 		}
@@ -137,8 +154,30 @@ func funcRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp,
 		args[i] = arg
 		dupM[arg] = struct{}{}
 	}
+	clo.Args = args
 
-	return NewClosure(args, body, env), nil
+	return clo, nil
+}
+
+// arg is "name" or ["name", type], type is nil if not annotated
+func funcArg(exp Exp) (string, Exp, error) {
+	if exp.Kind() == engine.StringValue {
+		name, err := engine.ToString(exp)
+		return name, nil, err
+	}
+
+	l, err := engine.ToListExp(exp)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(l) != 2 {
+		return "", nil, engine.NewSyntaxError("func", "expect [name type]")
+	}
+	name, err := engine.ToString(l[0])
+	if err != nil {
+		return "", nil, err
+	}
+	return name, l[1], nil
 }
 
 func applyRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp, error) {
@@ -151,9 +190,11 @@ func applyRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp
 	}
 
 	if len(l) == 0 {
-		return nil, errors.New("expect [func args ...]")
+		return nil, engine.NewSyntaxError("apply", "expect [func args ...]")
 	}
 
+	// read before sub expressions are reduced
+	site := callSite(ctx)
 	newCtx := EnsureEvalLevel(ctx, ExprLevel)
 	funcExp, err := interp.Interpret(newCtx, l[0], env)
 	if err != nil {
@@ -161,48 +202,183 @@ func applyRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp
 	}
 	argExps := l[1:]
 
-	// primitive
-	pri, err := ToPrimitive(funcExp)
-	if err == nil {
-		if len(argExps) != pri.Arity {
-			return nil, errors.New(fmt.Sprintf("invalid arity. expect %d args", pri.Arity))
+	arity, ok := funcArity(funcExp)
+	if !ok {
+		return nil, fmt.Errorf("cannot apply %s", funcExp.String())
+	}
+	if !arity.Accepts(len(argExps)) {
+		return nil, arityError(funcExp, calleeName(l[0]), len(argExps))
+	}
+
+	args := make([]Exp, len(argExps))
+	for i, argExp := range argExps {
+		arg, err := interp.Interpret(newCtx, argExp, env)
+		if err != nil {
+			return nil, err
 		}
+		args[i] = arg
+	}
 
-		args := make([]Exp, len(argExps))
-		for i, argExp := range argExps {
-			arg, err := interp.Interpret(newCtx, argExp, env)
-			if err != nil {
+	// closure body is a tail call, its frame is left by the interpreter loop,
+	// unless its post condition is checked after the body
+	clo, err := ToClosure(funcExp)
+	if contracts := ContractsEnabled(ctx); err == nil && !(clo.Post != nil && contracts) {
+		pushFrame(ctx, clo, site)
+		bodyCtx, bodyEnv := enterClosure(ctx, clo, args)
+		if contracts {
+			if err := checkPre(ctx, interp, clo, bodyCtx, bodyEnv); err != nil {
 				return nil, err
 			}
-			args[i] = arg
 		}
+		return engine.NewDelayedExp(bodyCtx, clo.Body, bodyEnv), nil
+	}
+
+	return applyFuncAt(ctx, interp, exp, funcExp, args)
+}
 
-		return pri.Func(args)
+func enterClosure(ctx Context, clo Closure, args []Exp) (Context, Env) {
+	kvs := make(map[string]Exp, len(clo.Args))
+	for i, arg := range args {
+		kvs[clo.Args[i]] = arg
 	}
 
-	// closure
-	clo, err := ToClosure(funcExp)
-	if err != nil {
-		return nil, err
+	newCtx := EnsureEvalLevel(enterModule(ctx, clo.Module), BlockLevel)
+	newEnv := clo.Env.Extend(kvs)
+	return newCtx, newEnv
+}
+
+// span of the redex being reduced, nil if unknown
+func callSite(ctx Context) *engine.Span {
+	stack := engine.GetCallStack(ctx)
+	if stack == nil {
+		return nil
 	}
+	return stack.Site()
+}
 
-	if len(argExps) != len(clo.Args) {
-		return nil, errors.New(fmt.Sprintf("invalid arity. expect %d args", len(clo.Args)))
+// pushFrame enters the frame of clo called at site, it returns false if there is no call stack
+func pushFrame(ctx Context, clo Closure, site *engine.Span) bool {
+	stack := engine.GetCallStack(ctx)
+	if stack == nil {
+		return false
 	}
+	f := engine.Frame{
+		Name: clo.Name,
+		Site: site,
+	}
+	if f.Name == "" {
+		f.Name = "func"
+	}
+	if clo.Module != nil {
+		f.Module = clo.Module.Name
+	}
+	stack.Push(f)
+	return true
+}
 
-	kvs := make(map[string]Exp, len(clo.Args))
-	for i, argExp := range argExps {
-		arg, err := interp.Interpret(newCtx, argExp, env)
+func popFrame(ctx Context) {
+	engine.GetCallStack(ctx).Pop()
+}
+
+// name of variable holding the function, empty if it is not a variable
+func calleeName(funcExp Exp) string {
+	r, err := engine.ToRedex(funcExp)
+	if err != nil || r.Name != "var" {
+		return ""
+	}
+	name, _ := engine.ToString(r.Exp)
+	return name
+}
+
+// ArityError is an error of applying a function to a wrong number of args
+type ArityError struct {
+	// name of the function, "function" if unknown
+	Func     string
+	Expected Arity
+	Got      int
+}
+
+func (e *ArityError) Error() string {
+	return fmt.Sprintf("invalid arity: %s expects %s, but found %d", e.Func, e.Expected.String(), e.Got)
+}
+
+// name is used unless the function has its own name
+func arityError(fn Exp, name string, n int) error {
+	arity, _ := funcArity(fn)
+	if c, err := ToCastedFunc(fn); err == nil {
+		fn = c.Func
+	}
+	if pri, err := ToPrimitive(fn); err == nil && pri.Name != "" {
+		name = pri.Name
+	}
+	if clo, err := ToClosure(fn); err == nil && name == "" {
+		name = clo.Name
+	}
+	if name == "" {
+		name = "function"
+	}
+	return &ArityError{Func: name, Expected: arity, Got: n}
+}
+
+// applyFunc applies function value to evaluated args, closure body is evaluated eagerly
+func applyFunc(ctx Context, interp Interpreter, fn Exp, args []Exp) (Exp, error) {
+	return applyFuncAt(ctx, interp, nil, fn, args)
+}
+
+// site is the call expression, nil if unknown
+func applyFuncAt(ctx Context, interp Interpreter, site Exp, fn Exp, args []Exp) (Exp, error) {
+	switch fn.Kind() {
+	case PrimitiveFuncValue:
+		pri, _ := ToPrimitive(fn)
+		if !pri.Arity.Accepts(len(args)) {
+			return nil, arityError(fn, "", len(args))
+		}
+		if err := engine.CheckCanceled(ctx); err != nil {
+			return nil, err
+		}
+		if err := checkCapability(ctx, pri); err != nil {
+			return nil, err
+		}
+		var (
+			val      Exp
+			err      error
+			reserved bool
+		)
+		if pri.CallFunc != nil {
+			call := newCallContext(ctx, interp, site)
+			val, err = pri.CallFunc(call, args)
+			reserved = call.reserved
+		} else {
+			val, err = pri.Func(args)
+		}
 		if err != nil {
 			return nil, err
 		}
-
-		kvs[clo.Args[i]] = arg
+		if meter := engine.GetMeter(ctx); meter != nil && !reserved {
+			if err := meter.Alloc(val); err != nil {
+				return nil, err
+			}
+		}
+		return val, nil
+	case ClosureValue:
+		clo, _ := ToClosure(fn)
+		if len(args) != len(clo.Args) {
+			return nil, arityError(fn, "", len(args))
+		}
+		if pushFrame(ctx, clo, callSite(ctx)) {
+			defer popFrame(ctx)
+		}
+		bodyCtx, bodyEnv := enterClosure(ctx, clo, args)
+		if clo.HasContract() && ContractsEnabled(ctx) {
+			return applyContracted(ctx, interp, clo, bodyCtx, bodyEnv)
+		}
+		return interp.Interpret(bodyCtx, clo.Body, bodyEnv)
+	case CastedFuncValue:
+		c, _ := ToCastedFunc(fn)
+		return applyCasted(ctx, interp, c, args)
+	default:
+		return nil, fmt.Errorf("cannot apply %s", fn.String())
 	}
-
-	newCtx = EnsureEvalLevel(ctx, BlockLevel)
-	newEnv := clo.Env.Extend(kvs)
-	return engine.NewDelayedExp(newCtx, clo.Body, newEnv), nil
 }
 
 func defRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp, error) {
@@ -230,6 +406,11 @@ func defRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp,
 		if err != nil {
 			return nil, err
 		}
+		// named for stack traces
+		if clo, err := ToClosure(val); err == nil && clo.Name == "" {
+			clo.Name = name
+			val = clo
+		}
 
 		vals[name] = val
 	}
@@ -278,7 +459,7 @@ func beginRedexIntepret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp,
 	}
 
 	if len(l) == 0 {
-		return nil, errors.New("empty begin sequence")
+		return nil, engine.NewSyntaxError("begin", "empty begin sequence")
 	}
 
 	for _, subExp := range l[:len(l)-1] {
@@ -302,7 +483,7 @@ func ifRedexIntepret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp, er
 	}
 
 	if len(l) != 3 {
-		return nil, errors.New("expect [test then else]")
+		return nil, engine.NewSyntaxError("if", "expect [test then else]")
 	}
 
 	newCtx := EnsureEvalLevel(ctx, ExprLevel)
@@ -322,6 +503,21 @@ func ifRedexIntepret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp, er
 	return engine.NewDelayedExp(newCtx, l[2], env), nil
 }
 
+func theRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp, error) {
+	// check level: any level
+	// type annotation is checked statically, only evaluate exp
+	l, err := engine.ToListExp(exp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(l) != 2 {
+		return nil, engine.NewSyntaxError("the", "expect [type exp]")
+	}
+
+	return engine.NewDelayedExp(ctx, l[1], env), nil
+}
+
 func blockRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp, error) {
 	// check level: any level
 	// body evaluated in BlockLevel
@@ -396,6 +592,16 @@ func GetCurrentModule(ctx Context) *Module {
 	return v.(*Module)
 }
 
+// closure bodies run in the module where the closure is created
+func enterModule(ctx Context, module *Module) Context {
+	if module == nil || GetCurrentModule(ctx) == module {
+		return ctx
+	}
+	return ctx.NewChild(map[string]interface{}{
+		CurrentModuleKey: module,
+	})
+}
+
 func isImport(exp Exp) bool {
 	r, err := engine.ToRedex(exp)
 	if err != nil {
@@ -407,13 +613,12 @@ func isImport(exp Exp) bool {
 func getStringValue(m map[string]Exp, key string) (string, error) {
 	exp, ok := m[key]
 	if !ok {
-		return "", fmt.Errorf("invalid module redex: empty %s", key)
+		return "", engine.NewSyntaxError("module", "empty %s", key)
 	}
 	return engine.ToString(exp)
 }
 
 // 先不做
-// 增加一个pass做name checking，类似type checking（先不做）
 // export在执行阶段，必须放在模块的最后面（先不做）
 // import时，隐式导入的名字相同，则不能使用该名字，使用则报错。
 // import时，隐式导入的名字和显式导入的名字相同，则使用显式导入的名字
@@ -447,7 +652,7 @@ func moduleRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Ex
 	}
 
 	if len(m) != 3 {
-		return nil, fmt.Errorf("invalid module redex: %v", m)
+		return nil, engine.NewSyntaxError("module", "%v", m)
 	}
 	// create module
 	moduleName, err := getStringValue(m, "name")
@@ -468,26 +673,40 @@ func moduleRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Ex
 		return nil, err
 	}
 
-	// init context
-	module := NewModule(moduleName, moduleFile, importValues)
-	state := module.LoadingState()
-	mt[moduleName] = module
-	ctx.Set(CurrentModuleKey, module)
-
 	// get module body
 	body, ok := m["body"]
 	if !ok {
-		return nil, fmt.Errorf("invalid module redex, missing body")
+		return nil, engine.NewSyntaxError("module", "missing body")
 	}
 	l, err := engine.ToListExp(body)
 	if err != nil {
 		return nil, err
 	}
 
+	// check names before running any code
+	if err := checkModuleNames(moduleName, importValues, l); err != nil {
+		return nil, err
+	}
+
+	// init context
+	module := NewModule(moduleName, moduleFile, importValues)
+	module.Typed = IsTyped(l...)
+	state := module.LoadingState()
+	mt[moduleName] = module
+	ctx.Set(CurrentModuleKey, module)
+
 	// evaluate module
+	var types map[string]Type
 	for _, subExp := range l {
 		if state.ImportingStage && !isImport(subExp) {
 			state.ImportingStage = false
+			// check types after imports, so imported types are known
+			if module.Typed {
+				types, err = CheckTypes(moduleName, l, importTypes(module.ImportValues))
+				if err != nil {
+					return nil, err
+				}
+			}
 			for name, importVal := range module.ImportValues {
 				env.Define(name, importVal.Value)
 			}
@@ -508,6 +727,16 @@ func moduleRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Ex
 		}
 		module.ExportValues[name] = val
 	}
+	if module.Typed {
+		module.ExportTypes = make(map[string]Type, len(names))
+		for name, defName := range names {
+			if t, ok := types[defName]; ok {
+				module.ExportTypes[name] = t
+			} else if ival, ok := module.ImportValues[defName]; ok && ival.Type != nil {
+				module.ExportTypes[name] = ival.Type
+			}
+		}
+	}
 	module.FinishLoading()
 
 	return engine.NewNull(), nil
@@ -562,7 +791,7 @@ func importSpecToNameMap(importSpecExp Exp) (map[string]*importName, error) {
 				return nil, err
 			}
 		default:
-			return nil, fmt.Errorf("expect [name explicit] or [name alias exlicit]")
+			return nil, engine.NewSyntaxError("import", "expect [name explicit] or [name alias exlicit]")
 		}
 		result[name] = &importName{
 			name:     alias,
@@ -572,7 +801,7 @@ func importSpecToNameMap(importSpecExp Exp) (map[string]*importName, error) {
 	return result, nil
 }
 
-func importValue(importValues map[string]*ImportVal, moduleName string, importName *importName, val Exp) error {
+func importValue(importValues map[string]*ImportVal, moduleName string, importName *importName, val Exp, t Type) error {
 	ival, ok := importValues[importName.name]
 	if ok {
 		if ival.Explicit {
@@ -583,14 +812,17 @@ func importValue(importValues map[string]*ImportVal, moduleName string, importNa
 			if importName.explicit {
 				ival.Value = val
 				ival.Explicit = true
+				ival.Type = t
 			} else {
 				ival.Value = NewAmbiguousValue()
+				ival.Type = nil
 			}
 		}
 	} else {
 		importValues[importName.name] = &ImportVal{
 			Value:    val,
 			Explicit: importName.explicit,
+			Type:     t,
 		}
 	}
 	return nil
@@ -615,13 +847,7 @@ func importRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Ex
 		return nil, err
 	}
 	if len(m) == 0 {
-		return nil, fmt.Errorf("empty import body")
-	}
-
-	// find module
-	loader := GetModuleLoader(ctx)
-	if loader == nil {
-		return nil, fmt.Errorf("missing module loader")
+		return nil, engine.NewSyntaxError("import", "empty import body")
 	}
 
 	for name, importSpecExp := range m {
@@ -630,7 +856,7 @@ func importRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Ex
 			return nil, err
 		}
 
-		module, err := loader.LoadModule(ctx, interp, name)
+		module, err := LoadModule(ctx, interp, name)
 		if err != nil {
 			return nil, err
 		}
@@ -642,10 +868,16 @@ func importRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Ex
 				return nil, fmt.Errorf("cannot import %s, no such name in module: %q", name, module.Name)
 			}
 
+			t := module.ExportTypes[name]
+			val, err := castImport(val, module, t, curModule)
+			if err != nil {
+				return nil, err
+			}
+
 			if level == TopLevel {
 				env.Define(importName.name, val)
 			} else {
-				err := importValue(curModule.ImportValues, module.Name, importName, val)
+				err := importValue(curModule.ImportValues, module.Name, importName, val, t)
 				if err != nil {
 					return nil, err
 				}
@@ -656,6 +888,40 @@ func importRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Ex
 	return engine.NewNull(), nil
 }
 
+// LoadModule finds module by name: loaded modules of the module table first,
+// then asking the module loader, at last builtin modules. so a module found by
+// the loader, like a file math.jsonp in its paths, shadows the builtin module
+func LoadModule(ctx Context, interp Interpreter, name string) (*Module, error) {
+	if err := checkModuleAllowed(ctx, name); err != nil {
+		return nil, err
+	}
+	if module, ok := GetModuleTable(ctx)[name]; ok && module.IsLoaded() {
+		return module, nil
+	}
+
+	loader := GetModuleLoader(ctx)
+	if loader == nil {
+		if module := GetBuiltinModule(name); module != nil {
+			return module, nil
+		}
+		return nil, &ModuleError{Module: name, Cause: errors.New("missing module loader")}
+	}
+	module, err := loader.LoadModule(ctx, interp, name)
+	if err != nil && isModuleNotFound(err, name) {
+		if builtin := GetBuiltinModule(name); builtin != nil {
+			return builtin, nil
+		}
+	}
+	return module, err
+}
+
+// module name itself is not found, not a module imported by it
+func isModuleNotFound(err error, name string) bool {
+	var moduleErr, importErr *ModuleError
+	return errors.As(err, &moduleErr) && moduleErr.Module == name &&
+		errors.Is(moduleErr.Cause, ErrModuleNotFound) && !errors.As(moduleErr.Cause, &importErr)
+}
+
 // export
 
 func exportRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Exp, error) {
@@ -671,7 +937,7 @@ func exportRedexInterpret(ctx Context, interp Interpreter, exp Exp, env Env) (Ex
 		return nil, err
 	}
 	if len(l) == 0 {
-		return nil, fmt.Errorf("empty export body")
+		return nil, engine.NewSyntaxError("export", "empty export body")
 	}
 
 	// collecting exportNames
@@ -704,7 +970,7 @@ func addExportNameToNameMap(subExp Exp, names map[string]string) error {
 			return err
 		}
 		if len(l) != 2 {
-			return fmt.Errorf("expect [name alias]")
+			return engine.NewSyntaxError("export", "expect [name alias]")
 		}
 		name, err := engine.ToString(l[0])
 		if err != nil {
@@ -719,7 +985,7 @@ func addExportNameToNameMap(subExp Exp, names map[string]string) error {
 		}
 		names[alias] = name
 	default:
-		return fmt.Errorf("invalid export spec: %s", subExp.String())
+		return engine.NewSyntaxError("export", "invalid export spec: %s", subExp.String())
 	}
 	return nil
 }
@@ -731,146 +997,167 @@ var (
 
 func init() {
 	preludeModule = &Module{
-		Name: "prelude",
-		ExportValues: map[string]Exp{
-			"+": NewPrimitive(2, func(vals []Exp) (Exp, error) {
-				n1, err := engine.ToNumber(vals[0])
-				if err != nil {
-					return nil, err
-				}
-
-				n2, err := engine.ToNumber(vals[1])
-				if err != nil {
-					return nil, err
-				}
-
-				return engine.NewNumber(n1 + n2), nil
+		Name:        "prelude",
+		ExportTypes: preludeTypes,
+		ExportValues: namePrimitives(map[string]Exp{
+			"+": foldNumbers(engine.NewInteger(0), engine.AddNumber),
+			"*": NewVariadicCallPrimitive(Arity{Min: 0, Max: Variadic}, func(call CallContext, vals []Exp) (Exp, error) {
+				// products are charged before they are computed
+				return foldNumberList(engine.NewInteger(1), func(a, b Exp) (Exp, error) {
+					if err := call.Reserve(engine.NumberValue, engine.MulDigits(a, b)); err != nil {
+						return nil, err
+					}
+					return engine.MulNumber(a, b)
+				}, vals)
 			}),
-			"-": NewPrimitive(2, func(vals []Exp) (Exp, error) {
-				n1, err := engine.ToNumber(vals[0])
-				if err != nil {
-					return nil, err
-				}
-
-				n2, err := engine.ToNumber(vals[1])
-				if err != nil {
-					return nil, err
-				}
-
-				return engine.NewNumber(n1 - n2), nil
+			"-": foldNumbersFrom(engine.NewInteger(0), engine.SubNumber),
+			"/": NewVariadicCallPrimitive(Arity{Min: 1, Max: Variadic}, func(call CallContext, vals []Exp) (Exp, error) {
+				dc := engine.GetDecimalContext(call.Context())
+				return foldNumberValuesFrom(engine.NewInteger(1), func(a, b Exp) (Exp, error) {
+					return engine.DivNumberWith(a, b, dc)
+				}, vals)
 			}),
-			"*": NewPrimitive(2, func(vals []Exp) (Exp, error) {
-				n1, err := engine.ToNumber(vals[0])
-				if err != nil {
-					return nil, err
-				}
-
-				n2, err := engine.ToNumber(vals[1])
-				if err != nil {
-					return nil, err
-				}
-
-				return engine.NewNumber(n1 * n2), nil
+			"<": compareNumbers(func(c int) bool {
+				return c < 0
+			}),
+			">": compareNumbers(func(c int) bool {
+				return c > 0
+			}),
+			"<=": compareNumbers(func(c int) bool {
+				return c <= 0
+			}),
+			">=": compareNumbers(func(c int) bool {
+				return c >= 0
 			}),
-			"/": NewPrimitive(2, func(vals []Exp) (Exp, error) {
-				n1, err := engine.ToNumber(vals[0])
+			"=": compareNumbers(func(c int) bool {
+				return c == 0
+			}),
+			"equal": NewPrimitive(2, func(vals []Exp) (Exp, error) {
+				return engine.NewBoolean(vals[0].Equal(vals[1])), nil
+			}),
+			"append-string": NewVariadicPrimitive(Arity{Min: 0, Max: Variadic}, func(vals []Exp) (Exp, error) {
+				strs, err := toStrings(vals)
 				if err != nil {
 					return nil, err
 				}
 
-				n2, err := engine.ToNumber(vals[1])
-				if err != nil {
-					return nil, err
+				return engine.NewString(strings.Join(strs, "")), nil
+			}),
+			"decimal": NewCallPrimitive(1, func(call CallContext, vals []Exp) (Exp, error) {
+				if s, err := engine.ToString(vals[0]); err == nil {
+					return engine.ParseDecimal(s)
 				}
-
-				return engine.NewNumber(n1 / n2), nil
+				return engine.NumberToDecimal(vals[0], engine.GetDecimalContext(call.Context()))
 			}),
-			"<": NewPrimitive(2, func(vals []Exp) (Exp, error) {
-				n1, err := engine.ToNumber(vals[0])
+			"decimal-round": NewCallPrimitive(3, func(call CallContext, vals []Exp) (Exp, error) {
+				d, err := engine.NumberToDecimal(vals[0], engine.GetDecimalContext(call.Context()))
 				if err != nil {
 					return nil, err
 				}
 
-				n2, err := engine.ToNumber(vals[1])
+				scale, err := decimalScale(vals[1])
 				if err != nil {
 					return nil, err
 				}
-
-				return engine.NewBoolean(n1 < n2), nil
-			}),
-			">": NewPrimitive(2, func(vals []Exp) (Exp, error) {
-				n1, err := engine.ToNumber(vals[0])
-				if err != nil {
+				// rounding to more fraction digits adds zeros
+				if err := call.Reserve(engine.NumberValue, int64(scale)); err != nil {
 					return nil, err
 				}
 
-				n2, err := engine.ToNumber(vals[1])
+				s, err := engine.ToString(vals[2])
 				if err != nil {
 					return nil, err
 				}
-
-				return engine.NewBoolean(n1 > n2), nil
-			}),
-			"<=": NewPrimitive(2, func(vals []Exp) (Exp, error) {
-				n1, err := engine.ToNumber(vals[0])
+				mode, err := engine.ParseRoundingMode(s)
 				if err != nil {
 					return nil, err
 				}
 
-				n2, err := engine.ToNumber(vals[1])
+				return d.Round(scale, mode), nil
+			}),
+			"decimal-format": NewCallPrimitive(2, func(call CallContext, vals []Exp) (Exp, error) {
+				dc := engine.GetDecimalContext(call.Context())
+				d, err := engine.NumberToDecimal(vals[0], dc)
 				if err != nil {
 					return nil, err
 				}
 
-				return engine.NewBoolean(n1 <= n2), nil
-			}),
-			">=": NewPrimitive(2, func(vals []Exp) (Exp, error) {
-				n1, err := engine.ToNumber(vals[0])
+				scale, err := decimalScale(vals[1])
 				if err != nil {
 					return nil, err
 				}
-
-				n2, err := engine.ToNumber(vals[1])
-				if err != nil {
+				if err := call.Reserve(engine.StringValue, int64(scale)); err != nil {
 					return nil, err
 				}
 
-				return engine.NewBoolean(n1 >= n2), nil
+				return engine.NewString(d.Round(scale, dc.Rounding).String()), nil
 			}),
-			"=": NewPrimitive(2, func(vals []Exp) (Exp, error) {
-				n1, err := engine.ToNumber(vals[0])
-				if err != nil {
-					return nil, err
-				}
+		}),
+	}
+}
 
-				n2, err := engine.ToNumber(vals[1])
-				if err != nil {
-					return nil, err
-				}
+// [x, y, ...], folded from init
+func foldNumbers(init Exp, op func(a, b Exp) (Exp, error)) Exp {
+	return NewVariadicPrimitive(Arity{Min: 0, Max: Variadic}, func(vals []Exp) (Exp, error) {
+		return foldNumberList(init, op, vals)
+	})
+}
 
-				return engine.NewBoolean(n1 == n2), nil
-			}),
-			"equal": NewPrimitive(2, func(vals []Exp) (Exp, error) {
-				return engine.NewBoolean(vals[0].Equal(vals[1])), nil
-			}),
-			"append-string": NewPrimitive(2, func(vals []Exp) (Exp, error) {
-				s1, err := engine.ToString(vals[0])
-				if err != nil {
-					return nil, err
-				}
+// [x] is op(init, x), [x, y, ...] is folded from x
+func foldNumbersFrom(init Exp, op func(a, b Exp) (Exp, error)) Exp {
+	return NewVariadicPrimitive(Arity{Min: 1, Max: Variadic}, func(vals []Exp) (Exp, error) {
+		return foldNumberValuesFrom(init, op, vals)
+	})
+}
 
-				s2, err := engine.ToString(vals[1])
-				if err != nil {
-					return nil, err
-				}
+func foldNumberValuesFrom(init Exp, op func(a, b Exp) (Exp, error), vals []Exp) (Exp, error) {
+	if len(vals) == 1 {
+		return op(init, vals[0])
+	}
+	return foldNumberList(vals[0], op, vals[1:])
+}
 
-				return engine.NewString(s1 + s2), nil
-			}),
-			"print": NewPrimitive(1, func(vals []Exp) (Exp, error) {
-				fmt.Println(vals[0].String())
+func foldNumberList(acc Exp, op func(a, b Exp) (Exp, error), vals []Exp) (Exp, error) {
+	if _, err := engine.ToNumeric(acc); err != nil {
+		return nil, err
+	}
+	for _, val := range vals {
+		var err error
+		acc, err = op(acc, val)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
 
-				return engine.NewNull(), nil
-			}),
-		},
+// chained comparison, true if test holds for every adjacent pair
+func compareNumbers(test func(c int) bool) Exp {
+	return NewVariadicPrimitive(Arity{Min: 1, Max: Variadic}, func(vals []Exp) (Exp, error) {
+		if _, err := engine.ToNumeric(vals[0]); err != nil {
+			return nil, err
+		}
+		result := true
+		for i := 1; i < len(vals); i++ {
+			c, err := engine.CompareNumber(vals[i-1], vals[i])
+			if err != nil {
+				return nil, err
+			}
+			result = result && test(c)
+		}
+		return engine.NewBoolean(result), nil
+	})
+}
+
+// number of fraction digits, a non negative integer
+func decimalScale(v Exp) (int32, error) {
+	i, err := engine.ToInteger(v)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := i.Int64()
+	if !ok || n < 0 || n > engine.MaxDecimalScale {
+		return 0, fmt.Errorf("invalid decimal scale: %s, at most %d", v.String(), engine.MaxDecimalScale)
 	}
+	return int32(n), nil
 }
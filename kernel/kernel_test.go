@@ -1,9 +1,14 @@
 package kernel
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/crcc/jsonp/engine"
 )
@@ -37,12 +42,18 @@ func init() {
 			{"def": {"fact": {"func": [["n"], ["factIter", "n", 1]]}}}
 
 			{"export": ["fact"]}`),
+			"geo": mustNewModule("geo", `
+			{"import": {"math": ["sqrt", "pow"]}}
+
+			{"def": {"hypot": {"func": [["x", "y"], ["sqrt", ["+", ["pow", "x", 2], ["pow", "y", 2]]]]}}}
+
+			{"export": ["hypot"]}`),
 			"main": mustNewModule("main", `
-				{"import": {"fact2": ["fact"]}}
+				{"import": {"fact2": ["fact"], "io": ["print"]}}
 				["print", ["fact", 6]]
 			`),
 			"main2": mustNewModule("main2", `
-				{"import": {"fact2": ["fact"], "fact": ["factRec"]}}
+				{"import": {"fact2": ["fact"], "fact": ["factRec"], "io": ["print"]}}
 				["print", ["+", ["fact", 6], ["factRec", 5]]]
 			`),
 		},
@@ -130,9 +141,9 @@ func TestInterpret_FactIter(t *testing.T) {
 }
 
 func TestInterpret_LoopForever(t *testing.T) {
-	t.Skip("loop forever, ignore it")
 	jsonStr := `
 	{"begin": [
+		{"import": {"io": ["print"]}},
 		{"def": {
 		  "loop": {"func": [[],
 					 ["print", {"data": "hello!"}],
@@ -143,10 +154,30 @@ func TestInterpret_LoopForever(t *testing.T) {
 
 	exp := mustParse(jsonStr)
 
-	val, err := interp(exp)
+	goCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ctx := engine.WithGoContext(engine.NewContext(map[string]interface{}{
+		EvalLevelKey: TopLevel,
+		StdoutKey:    io.Discard,
+	}), goCtx)
+
+	_, err := EvalTopLevel(ctx, NewKernelInterpreter(), exp, make(map[string]Exp))
+	if !engine.IsCanceled(err) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, but found %v", err)
+	}
+}
+
+func TestInterpret_Canceled(t *testing.T) {
+	goCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx := engine.WithGoContext(engine.NewContext(map[string]interface{}{
+		EvalLevelKey: TopLevel,
+	}), goCtx)
 
-	t.Log(err)
-	t.Log(val)
+	_, err := EvalTopLevel(ctx, NewKernelInterpreter(), mustParse(`["+", 1, 2]`), make(map[string]Exp))
+	if !engine.IsCanceled(err) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled, but found %v", err)
+	}
 }
 
 func TestModule_Simple_TopLevel(t *testing.T) {
@@ -240,3 +271,463 @@ func TestModule_File_ModuleLevel(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 }
+
+func TestContract_Pre(t *testing.T) {
+	e := mustParse(`{"begin": [
+		{"def": {
+		  "sub1": {"func": [["n"],
+					{"pre": [">", "n", 0]},
+					{"post": [">=", "result", 0]},
+					["-", "n", 1]]}
+		}},
+		["sub1", 0]
+	]}`)
+
+	_, err := interp(e)
+	var cerr *ContractError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expect contract error, but found %v", err)
+	}
+	if cerr.Clause != PreContract || cerr.Blame() != "top level" {
+		t.Fatalf("unexpected contract error: %s", cerr.Error())
+	}
+
+	val, err := interp(mustParse(`{"begin": [
+		{"def": {"sub1": {"func": [["n"], {"pre": [">", "n", 0]}, ["-", "n", 1]]}}},
+		["sub1", 3]
+	]}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !engine.NewNumber(2).Equal(val) {
+		t.Fatalf("expect 2")
+	}
+}
+
+func TestContract_Post(t *testing.T) {
+	e := mustParse(`{"begin": [
+		{"def": {
+		  "bad": {"func": [["n"], {"post": [">", "result", "n"]}, ["-", "n", 1]]}
+		}},
+		["bad", 5]
+	]}`)
+
+	_, err := interp(e)
+	var cerr *ContractError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expect contract error, but found %v", err)
+	}
+	if cerr.Clause != PostContract {
+		t.Fatalf("unexpected contract error: %s", cerr.Error())
+	}
+
+	evalS.SetContracts(false)
+	defer evalS.SetContracts(true)
+	val, err := interp(e)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !engine.NewNumber(4).Equal(val) {
+		t.Fatalf("expect 4")
+	}
+}
+
+func TestContract_TailCall(t *testing.T) {
+	loop := func(n int) (Exp, error) {
+		ctx, _ := engine.WithLimits(engine.NewContext(map[string]interface{}{
+			EvalLevelKey: TopLevel,
+		}), engine.Limits{MaxDepth: 100})
+		return EvalTopLevel(ctx, NewKernelInterpreter(), mustParse(fmt.Sprintf(`{"begin": [
+			{"def": {"loop": {"func": [["n"], {"pre": [">=", "n", 0]}, {"if": [["=", "n", 0], 0, ["loop", ["-", "n", 1]]]}]}}},
+			["loop", %d]
+		]}`, n)), make(map[string]Exp))
+	}
+
+	// pre condition does not stop tail calls
+	if _, err := loop(300); err != nil {
+		t.Fatal(err.Error())
+	}
+	var cerr *ContractError
+	if _, err := loop(-1); !errors.As(err, &cerr) || cerr.Clause != PreContract {
+		t.Fatalf("expect pre condition error, but found %v", err)
+	}
+
+	// result of post condition cannot shadow an arg
+	if _, err := parse(`{"func": [["result"], {"post": [">", "result", 0]}, "result"]}`); err == nil {
+		t.Fatal("expect arg result rejected")
+	}
+	if _, err := parse(`{"func": [["result"], {"pre": [">", "result", 0]}, "result"]}`); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestInterpret_BigFact(t *testing.T) {
+	e := mustParse(`{"begin": [
+		{"def": {
+		  "fact": {"func": [["n"],
+					 {"if": [["<=", "n", 0],
+							 1,
+							 ["*", "n", ["fact", ["-", "n", 1]]]]}
+				  ]}
+		}},
+		["fact", 25]
+	]}`)
+
+	val, err := interp(e)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "15511210043330985984000000" {
+		t.Fatalf("expect 15511210043330985984000000, but found %s", val.String())
+	}
+
+	val, err = interp(mustParse(`["+", 9007199254740993, 0]`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "9007199254740993" {
+		t.Fatalf("expect 9007199254740993, but found %s", val.String())
+	}
+}
+
+func TestInterpret_Decimal(t *testing.T) {
+	cases := map[string]string{
+		`["+", {"decimal": "0.1"}, {"decimal": 0.2}]`:                     "0.3",
+		`["=", ["+", {"decimal": "0.1"}, {"decimal": "0.2"}], 0.3]`:       "true",
+		`["equal", {"decimal": "2.50"}, ["/", 5, 2]]`:                     "true",
+		`["decimal", ["/", 1, 8]]`:                                        "0.125",
+		`["decimal-round", {"decimal": "2.345"}, 2, {"data": "half-up"}]`: "2.35",
+		`["decimal-format", ["*", {"decimal": "19.99"}, 3], 4]`:           `"59.9700"`,
+	}
+	for src, expected := range cases {
+		val, err := interp(mustParse(src))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if val.String() != expected {
+			t.Fatalf("%s: expect %s, but found %s", src, expected, val.String())
+		}
+	}
+
+	if _, err := parse(`{"decimal": "1.2.3"}`); err == nil {
+		t.Fatal("expect invalid decimal literal")
+	}
+	if _, err := parse(`{"decimal": "1e999999999"}`); err == nil {
+		t.Fatal("expect decimal scale out of range")
+	}
+	for _, src := range []string{
+		`["decimal-round", 1, 2000000000, {"data": "half-up"}]`,
+		`["decimal-format", 1, 10001]`,
+	} {
+		if _, err := interp(mustParse(src)); err == nil || !strings.Contains(err.Error(), "invalid decimal scale") {
+			t.Fatalf("%s: expect invalid decimal scale, but found %v", src, err)
+		}
+	}
+}
+
+func TestInterpret_Math(t *testing.T) {
+	cases := map[string]string{
+		`{"begin": [{"import": {"geo": ["hypot"]}}, ["hypot", 3, 4]]}`:                     "5",
+		`{"begin": [{"import": {"math": ["mod"]}}, ["mod", -7, 2]]}`:                       "1",
+		`{"begin": [{"import": {"math": ["quot"]}}, ["quot", -7, 2]]}`:                     "-3",
+		`{"begin": [{"import": {"math": ["round"]}}, ["round", 2.5]]}`:                     "2",
+		`{"begin": [{"import": {"math": ["pow"]}}, ["pow", 2, -2]]}`:                       "0.25",
+		`{"begin": [{"import": {"math": ["max"]}}, ["max", 1, 1.5]]}`:                      "1.5",
+		`{"begin": [{"import": {"math": ["inf?", "pow"]}}, ["inf?", ["pow", 10.0, 400]]]}`: "true",
+		`{"begin": [{"import": {"math": ["shift-left"]}}, ["shift-left", 1, 70]]}`:         "1180591620717411303424",
+	}
+	for src, expected := range cases {
+		val, err := interp(mustParse(src))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if val.String() != expected {
+			t.Fatalf("%s: expect %s, but found %s", src, expected, val.String())
+		}
+	}
+
+	for _, src := range []string{
+		`{"begin": [{"import": {"math": ["mod"]}}, ["mod", 1, 0]]}`,
+		`{"begin": [{"import": {"math": ["sqrt"]}}, ["sqrt", -1]]}`,
+		`{"begin": [{"import": {"math": ["log"]}}, ["log", 0]]}`,
+		`{"begin": [{"import": {"math": ["inf"]}}, ["-", "inf", "inf"]]}`,
+	} {
+		if _, err := interp(mustParse(src)); err == nil {
+			t.Fatalf("%s: expect error", src)
+		}
+	}
+}
+
+func TestModule_BuiltinShadowed(t *testing.T) {
+	loader := &SimpleModuleLoader{
+		Modules: map[string]Exp{
+			"math": mustNewModule("math", `
+			{"def": {"sqrt": {"func": [["x"], {"data": "mine"}]}}}
+			{"export": ["sqrt"]}`),
+			"string": mustNewModule("string", `
+			{"import": {"no-such-module": ["x"]}}`),
+		},
+	}
+	repl := NewRepl(engine.ParserFunc(ParseJson), NewKernelInterpreter(), loader)
+
+	// module of the loader wins over the builtin one
+	val, err := repl.EvalInteractive(mustParse(`{"begin": [{"import": {"math": ["sqrt"]}}, ["sqrt", 4]]}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != `"mine"` {
+		t.Fatalf("expect module of loader, but found %s", val.String())
+	}
+
+	// builtin module, if the loader does not find it
+	val, err = repl.EvalInteractive(mustParse(`{"begin": [{"import": {"list": ["length"]}}, ["length", {"data": [1]}]]}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "1" {
+		t.Fatalf("expect 1, but found %s", val.String())
+	}
+
+	// missing import of a found module is reported, not hidden by the builtin one
+	_, err = repl.EvalInteractive(mustParse(`{"begin": [{"import": {"string": ["upper"]}}, "upper"]}`))
+	var moduleErr *ModuleError
+	if !errors.As(err, &moduleErr) || moduleErr.Module != "string" || !errors.Is(err, ErrModuleNotFound) {
+		t.Fatalf("expect error of module string, but found %v", err)
+	}
+}
+
+func TestInterpret_List(t *testing.T) {
+	imports := `{"import": {"list": ["length", "nth", "slice", "cons", "concat", "map", "filter", "reduce",
+		"sort-by", "zip", "range", "reverse", "find", "any?", "all?"]}}`
+	withImports := func(src string) Exp {
+		return mustParse(`{"begin": [` + imports + `, ` + src + `]}`)
+	}
+
+	cases := map[string]string{
+		`["length", {"data": [1, 2, 3]}]`:                                "3",
+		`["nth", {"data": [1, 2, 3]}, 1]`:                                "2",
+		`["slice", ["range", 0, 10], 2, 5]`:                              "[2, 3, 4]",
+		`["cons", 0, ["concat", {"data": [1]}, {"data": [2]}]]`:          "[0, 1, 2]",
+		`["map", {"func": [["x"], ["*", "x", "x"]]}, ["range", 1, 4]]`:   "[1, 4, 9]",
+		`["filter", {"func": [["x"], [">", "x", 1]]}, ["range", 0, 4]]`:  "[2, 3]",
+		`["reduce", "+", 0, ["range", 0, 5]]`:                            "10",
+		`["sort-by", {"func": [["x"], ["-", 0, "x"]]}, ["range", 0, 3]]`: "[2, 1, 0]",
+		`["zip", ["range", 0, 3], ["reverse", ["range", 0, 2]]]`:         "[[0, 1], [1, 0]]",
+		`["find", {"func": [["x"], [">", "x", 5]]}, ["range", 0, 3]]`:    "null",
+		`["any?", {"func": [["x"], ["=", "x", 2]]}, ["range", 0, 3]]`:    "true",
+		`["all?", {"func": [["x"], ["<", "x", 2]]}, ["range", 0, 3]]`:    "false",
+	}
+	for src, expected := range cases {
+		val, err := interp(withImports(src))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if val.String() != expected {
+			t.Fatalf("%s: expect %s, but found %s", src, expected, val.String())
+		}
+	}
+
+	if _, err := interp(withImports(`["nth", {"data": [1]}, 1]`)); err == nil {
+		t.Fatal("expect index out of range")
+	}
+	if _, err := interp(withImports(`["range", -4611686018427387904, 4611686018427387904]`)); err == nil || !strings.Contains(err.Error(), "length out of range") {
+		t.Fatalf("expect length out of range, but found %v", err)
+	}
+}
+
+func TestInterpret_Map(t *testing.T) {
+	imports := `{"import": {"map": ["get", "get-or", "get-in", "assoc", "assoc-in", "dissoc", "update", "update-in",
+		"keys", "vals", "entries", "merge", "deep-merge", "select-keys"]}}`
+	withImports := func(src string) Exp {
+		return mustParse(`{"begin": [` + imports + `, {"def": {"m": {"data": {"b": 1, "a": {"x": [10, 20]}}}}}, ` + src + `]}`)
+	}
+
+	cases := map[string]string{
+		`["get", "m", {"data": "b"}]`:                                                   "1",
+		`["get", "m", {"data": "c"}]`:                                                   "null",
+		`["get-or", "m", {"data": "c"}, 0]`:                                             "0",
+		`["get-in", "m", {"data": ["a", "x", 1]}]`:                                      "20",
+		`["assoc", "m", {"data": "b"}, 2]`:                                              `{"a": {"x": [10, 20]}, "b": 2}`,
+		`["assoc-in", "m", {"data": ["c", "d"]}, 3]`:                                    `{"a": {"x": [10, 20]}, "b": 1, "c": {"d": 3}}`,
+		`["dissoc", "m", {"data": "a"}]`:                                                `{"b": 1}`,
+		`["update", "m", {"data": "b"}, {"func": [["v"], ["+", "v", 1]]}]`:              `{"a": {"x": [10, 20]}, "b": 2}`,
+		`["update-in", "m", {"data": ["a", "x", 0]}, {"func": [["v"], ["*", "v", 2]]}]`: `{"a": {"x": [20, 20]}, "b": 1}`,
+		`["keys", "m"]`:                                                              `["a", "b"]`,
+		`["vals", {"data": {"y": 2, "x": 1}}]`:                                       "[1, 2]",
+		`["entries", {"data": {"y": 2, "x": 1}}]`:                                    `[["x", 1], ["y", 2]]`,
+		`["merge", "m", {"data": {"a": 0}}]`:                                         `{"a": 0, "b": 1}`,
+		`["deep-merge", "m", {"data": {"a": {"y": 0}}}]`:                             `{"a": {"x": [10, 20], "y": 0}, "b": 1}`,
+		`["select-keys", "m", {"data": ["b", "c"]}]`:                                 `{"b": 1}`,
+		`{"begin": [["assoc", "m", {"data": "b"}, 2], ["get", "m", {"data": "b"}]]}`: "1",
+	}
+	for src, expected := range cases {
+		val, err := interp(withImports(src))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if val.String() != expected {
+			t.Fatalf("%s: expect %s, but found %s", src, expected, val.String())
+		}
+	}
+}
+
+func TestInterpret_String(t *testing.T) {
+	imports := `{"import": {"string": ["length", "substring", "split", "join", "trim", "upper", "replace",
+		"starts-with?", "index-of", "repeat", "pad-left", "string->number", "number->string", "format"]}}`
+	withImports := func(src string) Exp {
+		return mustParse(`{"begin": [` + imports + `, ` + src + `]}`)
+	}
+
+	cases := map[string]string{
+		`["length", {"data": "héllo, 世界"}]`:                                                     "9",
+		`["substring", {"data": "héllo, 世界"}, 7, 9]`:                                            `"世界"`,
+		`["index-of", {"data": "héllo, 世界"}, {"data": "界"}]`:                                    "8",
+		`["join", ["split", {"data": "a,b,c"}, {"data": ","}], {"data": "-"}]`:                  `"a-b-c"`,
+		`["upper", ["trim", {"data": "  abc "}]]`:                                               `"ABC"`,
+		`["replace", {"data": "aXbX"}, {"data": "X"}, {"data": "_"}]`:                           `"a_b_"`,
+		`["replace", {"data": "世界"}, {"data": ""}, {"data": "-"}]`:                              `"-世-界-"`,
+		`["starts-with?", {"data": "jsonp"}, {"data": "json"}]`:                                 "true",
+		`["repeat", {"data": "ab"}, 3]`:                                                         `"ababab"`,
+		`["pad-left", {"data": "7"}, 3, {"data": "0"}]`:                                         `"007"`,
+		`["+", ["string->number", {"data": "12"}], 1]`:                                          "13",
+		`["number->string", 1.5]`:                                                               `"1.5"`,
+		`["format", {"data": "%s has %d items, %.2f"}, {"data": ["cart", 3, 2.5]}]`:             `"cart has 3 items, 2.50"`,
+		`["format", {"data": "{name} is {age}, {{ok}}"}, {"data": {"name": "Bob", "age": 30}}]`: `"Bob is 30, {ok}"`,
+		`["format", {"data": "}}{a}{a}"}, {"data": {"a": 1}}]`:                                  `"}11"`,
+	}
+	for src, expected := range cases {
+		val, err := interp(withImports(src))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if val.String() != expected {
+			t.Fatalf("%s: expect %s, but found %s", src, expected, val.String())
+		}
+	}
+
+	for _, src := range []string{
+		`["string->number", {"data": "abc"}]`,
+		`["format", {"data": "{missing}"}, {"data": {}}]`,
+		`["substring", {"data": "abc"}, 2, 4]`,
+		`["repeat", {"data": "ab"}, 4611686018427387904]`,
+		`["pad-left", {"data": "7"}, 4611686018427387904, {"data": "0"}]`,
+	} {
+		if _, err := interp(withImports(src)); err == nil {
+			t.Fatalf("%s: expect error", src)
+		}
+	}
+}
+
+func TestInterpret_Regex(t *testing.T) {
+	imports := `{"import": {"regex": ["re-match?", "re-find", "re-find-all", "re-replace", "re-split"]}}`
+	withImports := func(src string) Exp {
+		return mustParse(`{"begin": [` + imports + `, ` + src + `]}`)
+	}
+
+	cases := map[string]string{
+		`["re-match?", {"regex": "^a+b$"}, {"data": "aaab"}]`:                                                    "true",
+		`["re-find", {"regex": "[0-9]+"}, {"data": "ab12cd345"}]`:                                                `"12"`,
+		`["re-find", {"regex": "x"}, {"data": "abc"}]`:                                                           "null",
+		`["re-find", {"data": "(a)(b)?"}, {"data": "a"}]`:                                                        `["a", "a", null]`,
+		`["re-find-all", {"regex": "(?P<k>\\w+)=(?P<v>\\w+)"}, {"data": "a=1 b=2"}]`:                             `[{"k": "a", "v": "1"}, {"k": "b", "v": "2"}]`,
+		`["re-replace", {"regex": "(\\w+)@"}, {"data": "bob@x"}, {"data": "<$1>@"}]`:                             `"<bob>@x"`,
+		`["re-replace", {"regex": "[0-9]+"}, {"data": "a1b22"}, {"func": [["m"], ["append-string", "m", "m"]]}]`: `"a11b2222"`,
+		`["re-split", {"regex": "\\s*,\\s*"}, {"data": "a , b,c"}]`:                                              `["a", "b", "c"]`,
+	}
+	for src, expected := range cases {
+		val, err := interp(withImports(src))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if val.String() != expected {
+			t.Fatalf("%s: expect %s, but found %s", src, expected, val.String())
+		}
+	}
+
+	re1, _ := CompileRegex("a+")
+	re2, _ := CompileRegex("a+")
+	if re1.Regexp != re2.Regexp {
+		t.Fatal("expect cached regex")
+	}
+	for i := 0; i < 2*maxCachedRegexes; i++ {
+		if _, err := CompileRegex(fmt.Sprintf("a{%d}", i)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if n := regexCache.len(); n != maxCachedRegexes {
+		t.Fatalf("expect %d cached regexes, but found %d", maxCachedRegexes, n)
+	}
+	if _, err := parse(`{"regex": "("}`); err == nil {
+		t.Fatal("expect invalid regex")
+	}
+}
+
+func TestInterpret_Variadic(t *testing.T) {
+	cases := map[string]string{
+		`["+", 1, 2, 3]`:   "6",
+		`["+"]`:            "0",
+		`["-", 5]`:         "-5",
+		`["-", 10, 1, 2]`:  "7",
+		`["/", 2]`:         "0.5",
+		`["*", 2, 3, 4]`:   "24",
+		`["<", 1, 2, 3]`:   "true",
+		`["<", 1, 3, 2]`:   "false",
+		`["=", 1, 1.0, 1]`: "true",
+		`["append-string", {"data": "a"}, {"data": "b"}, {"data": "c"}]`: `"abc"`,
+	}
+	for src, expected := range cases {
+		val, err := interp(mustParse(src))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if val.String() != expected {
+			t.Fatalf("%s: expect %s, but found %s", src, expected, val.String())
+		}
+	}
+
+	_, err := interp(mustParse(`["<"]`))
+	if err == nil || !strings.Contains(err.Error(), "< expects at least 1 args, but found 0") {
+		t.Fatalf("expect arity error naming <, but found %v", err)
+	}
+	_, err = interp(mustParse(`{"begin": [{"def": {"f": {"func": [["x"], "x"]}}}, ["f", 1, 2]]}`))
+	if err == nil || !strings.Contains(err.Error(), "f expects 1 args, but found 2") {
+		t.Fatalf("expect arity error naming f, but found %v", err)
+	}
+}
+
+func TestInterpret_TypedErrors(t *testing.T) {
+	_, err := interp(mustParse(`["<"]`))
+	var arityErr *ArityError
+	if !errors.As(err, &arityErr) || arityErr.Func != "<" || arityErr.Got != 0 {
+		t.Fatalf("expect arity error of <, but found %v", err)
+	}
+
+	_, err = interp(mustParse(`{"begin": [{"def": {"f": {"func": [["x"], ["+", "x", 1]]}}}, ["f", {"data": "a"}]]}`))
+	var typeErr *engine.TypeError
+	if !errors.As(err, &typeErr) || typeErr.Expected != engine.NumberValue || !typeErr.Got.Equal(engine.NewString("a")) {
+		t.Fatalf("expect type error of number, but found %v", err)
+	}
+	if !errors.Is(err, engine.ErrNotNumberValue) {
+		t.Fatalf("expect not number value, but found %v", err)
+	}
+
+	_, err = parse(`{"begin": [1, {"if": [1, 2]}]}`)
+	var syntaxErr *engine.SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Form != "if" || syntaxErr.Span == nil || syntaxErr.Span.String() != "1:15" {
+		t.Fatalf("expect syntax error of if at 1:15, but found %v", err)
+	}
+
+	_, err = interp(mustParse(`{"begin": [{"import": {"no-such-module": ["x"]}}, "x"]}`))
+	var moduleErr *ModuleError
+	if !errors.As(err, &moduleErr) || moduleErr.Module != "no-such-module" || !errors.Is(err, ErrModuleNotFound) {
+		t.Fatalf("expect module not found, but found %v", err)
+	}
+
+	// kinds of kernel values are named
+	if msg := engine.NewTypeError(ClosureValue, engine.NewInteger(1), nil).Error(); msg != "expect closure, but found 1" {
+		t.Fatalf("expect closure named, but found %s", msg)
+	}
+	if name := RegexValue.String(); name != "regex" {
+		t.Fatalf("expect regex, but found %s", name)
+	}
+}
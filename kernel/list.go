@@ -0,0 +1,354 @@
+package kernel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+// list module, lists are never mutated
+
+const ListModuleName = "list"
+
+func init() {
+	RegisterBuiltinModule(newListModule())
+}
+
+// maxSeqLength bounds lists and strings made by primitives, so that they fail instead of exhausting memory
+const maxSeqLength = 1 << 26
+
+func checkSeqLength(n uint64) error {
+	if n > maxSeqLength {
+		return fmt.Errorf("length out of range: %d, at most %d", n, maxSeqLength)
+	}
+	return nil
+}
+
+func toIndex(v Exp) (int, error) {
+	i, err := engine.ToInteger(v)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := i.Int64()
+	if !ok || n != int64(int(n)) {
+		return 0, fmt.Errorf("index out of range: %s", v.String())
+	}
+	return int(n), nil
+}
+
+func listFunc1(f func(l []Exp) (Exp, error)) Exp {
+	return NewPrimitive(1, func(vals []Exp) (Exp, error) {
+		l, err := engine.ToList(vals[0])
+		if err != nil {
+			return nil, err
+		}
+		return f(l)
+	})
+}
+
+// higher order list function, [f, list]
+func listHigherOrder(f func(call CallContext, fn Exp, l []Exp) (Exp, error)) Exp {
+	return NewCallPrimitive(2, func(call CallContext, vals []Exp) (Exp, error) {
+		l, err := engine.ToList(vals[1])
+		if err != nil {
+			return nil, err
+		}
+		return f(call, vals[0], l)
+	})
+}
+
+func applyPredicate(call CallContext, fn Exp, arg Exp) (bool, error) {
+	val, err := call.Apply(fn, arg)
+	if err != nil {
+		return false, err
+	}
+	b, err := engine.ToBoolean(val)
+	if err != nil {
+		return false, call.Errorf("predicate should return boolean, but found %s", val.String())
+	}
+	return b, nil
+}
+
+// numbers and strings are ordered, others are not
+func compareValues(a, b Exp) (int, error) {
+	if a.Kind() == engine.StringValue && b.Kind() == engine.StringValue {
+		s1, _ := engine.ToString(a)
+		s2, _ := engine.ToString(b)
+		return strings.Compare(s1, s2), nil
+	}
+	if a.Kind() == engine.NumberValue && b.Kind() == engine.NumberValue {
+		return engine.CompareNumber(a, b)
+	}
+	return 0, fmt.Errorf("cannot compare %s and %s", a.String(), b.String())
+}
+
+func newListModule() *Module {
+	values := map[string]Exp{
+		"length": listFunc1(func(l []Exp) (Exp, error) {
+			return engine.NewInteger(int64(len(l))), nil
+		}),
+		"empty?": listFunc1(func(l []Exp) (Exp, error) {
+			return engine.NewBoolean(len(l) == 0), nil
+		}),
+		"first": listFunc1(func(l []Exp) (Exp, error) {
+			if len(l) == 0 {
+				return nil, fmt.Errorf("first of empty list")
+			}
+			return l[0], nil
+		}),
+		"rest": listFunc1(func(l []Exp) (Exp, error) {
+			if len(l) == 0 {
+				return nil, fmt.Errorf("rest of empty list")
+			}
+			return engine.NewList(l[1:]), nil
+		}),
+		"reverse": listFunc1(func(l []Exp) (Exp, error) {
+			newL := make([]Exp, len(l))
+			for i, val := range l {
+				newL[len(l)-1-i] = val
+			}
+			return engine.NewList(newL), nil
+		}),
+		"nth": NewPrimitive(2, func(vals []Exp) (Exp, error) {
+			l, err := engine.ToList(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			i, err := toIndex(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			if i < 0 || i >= len(l) {
+				return nil, fmt.Errorf("index out of range: %d, length is %d", i, len(l))
+			}
+			return l[i], nil
+		}),
+		// [list, start, end), end is exclusive
+		"slice": NewPrimitive(3, func(vals []Exp) (Exp, error) {
+			l, err := engine.ToList(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			start, err := toIndex(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			end, err := toIndex(vals[2])
+			if err != nil {
+				return nil, err
+			}
+			if start < 0 || end > len(l) || start > end {
+				return nil, fmt.Errorf("slice out of range: [%d, %d), length is %d", start, end, len(l))
+			}
+			return engine.NewList(l[start:end]), nil
+		}),
+		"cons": NewPrimitive(2, func(vals []Exp) (Exp, error) {
+			l, err := engine.ToList(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			newL := make([]Exp, 0, len(l)+1)
+			return engine.NewList(append(append(newL, vals[0]), l...)), nil
+		}),
+		"concat": NewPrimitive(2, func(vals []Exp) (Exp, error) {
+			l1, err := engine.ToList(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			l2, err := engine.ToList(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			newL := make([]Exp, 0, len(l1)+len(l2))
+			return engine.NewList(append(append(newL, l1...), l2...)), nil
+		}),
+		"zip": NewPrimitive(2, func(vals []Exp) (Exp, error) {
+			l1, err := engine.ToList(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			l2, err := engine.ToList(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			n := len(l1)
+			if len(l2) < n {
+				n = len(l2)
+			}
+			newL := make([]Exp, n)
+			for i := range newL {
+				newL[i] = engine.NewList([]Exp{l1[i], l2[i]})
+			}
+			return engine.NewList(newL), nil
+		}),
+		// integers in [start, end)
+		"range": NewCallPrimitive(2, func(call CallContext, vals []Exp) (Exp, error) {
+			start, err := toIndex(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			end, err := toIndex(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			if end < start {
+				return engine.NewList([]Exp{}), nil
+			}
+			// exact even if end-start overflows int
+			n := uint64(end) - uint64(start)
+			if err := checkSeqLength(n); err != nil {
+				return nil, err
+			}
+			if err := call.Reserve(engine.ListValue, int64(n)); err != nil {
+				return nil, err
+			}
+			newL := make([]Exp, n)
+			for i := range newL {
+				newL[i] = engine.NewInteger(int64(start + i))
+			}
+			return engine.NewList(newL), nil
+		}),
+
+		"map": listHigherOrder(func(call CallContext, fn Exp, l []Exp) (Exp, error) {
+			newL := make([]Exp, len(l))
+			for i, val := range l {
+				newVal, err := call.Apply(fn, val)
+				if err != nil {
+					return nil, err
+				}
+				newL[i] = newVal
+			}
+			return engine.NewList(newL), nil
+		}),
+		"filter": listHigherOrder(func(call CallContext, fn Exp, l []Exp) (Exp, error) {
+			newL := make([]Exp, 0, len(l))
+			for _, val := range l {
+				ok, err := applyPredicate(call, fn, val)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					newL = append(newL, val)
+				}
+			}
+			return engine.NewList(newL), nil
+		}),
+		// first element satisfying f, null if not found
+		"find": listHigherOrder(func(call CallContext, fn Exp, l []Exp) (Exp, error) {
+			for _, val := range l {
+				ok, err := applyPredicate(call, fn, val)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					return val, nil
+				}
+			}
+			return engine.NewNull(), nil
+		}),
+		"any?": listHigherOrder(func(call CallContext, fn Exp, l []Exp) (Exp, error) {
+			for _, val := range l {
+				ok, err := applyPredicate(call, fn, val)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					return engine.NewBoolean(true), nil
+				}
+			}
+			return engine.NewBoolean(false), nil
+		}),
+		"all?": listHigherOrder(func(call CallContext, fn Exp, l []Exp) (Exp, error) {
+			for _, val := range l {
+				ok, err := applyPredicate(call, fn, val)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					return engine.NewBoolean(false), nil
+				}
+			}
+			return engine.NewBoolean(true), nil
+		}),
+		// stable sort by key of f, keys are numbers or strings
+		"sort-by": listHigherOrder(func(call CallContext, fn Exp, l []Exp) (Exp, error) {
+			keys := make([]Exp, len(l))
+			for i, val := range l {
+				key, err := call.Apply(fn, val)
+				if err != nil {
+					return nil, err
+				}
+				keys[i] = key
+			}
+
+			indexes := make([]int, len(l))
+			for i := range indexes {
+				indexes[i] = i
+			}
+			var sortErr error
+			sort.SliceStable(indexes, func(i, j int) bool {
+				c, err := compareValues(keys[indexes[i]], keys[indexes[j]])
+				if err != nil && sortErr == nil {
+					sortErr = err
+				}
+				return c < 0
+			})
+			if sortErr != nil {
+				return nil, sortErr
+			}
+
+			newL := make([]Exp, len(l))
+			for i, index := range indexes {
+				newL[i] = l[index]
+			}
+			return engine.NewList(newL), nil
+		}),
+		// [f, init, list], f is called with accumulator and element
+		"reduce": NewCallPrimitive(3, func(call CallContext, vals []Exp) (Exp, error) {
+			l, err := engine.ToList(vals[2])
+			if err != nil {
+				return nil, err
+			}
+			acc := vals[1]
+			for _, val := range l {
+				acc, err = call.Apply(vals[0], acc, val)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return acc, nil
+		}),
+	}
+
+	var (
+		anyList   = ListType{Elem: anyType}
+		unaryFunc = FuncType{Params: []Type{anyType}, Result: anyType}
+	)
+	types := map[string]Type{
+		"length":  FuncType{Params: []Type{anyList}, Result: numberType},
+		"empty?":  FuncType{Params: []Type{anyList}, Result: booleanType},
+		"first":   FuncType{Params: []Type{anyList}, Result: anyType},
+		"rest":    FuncType{Params: []Type{anyList}, Result: anyList},
+		"reverse": FuncType{Params: []Type{anyList}, Result: anyList},
+		"nth":     FuncType{Params: []Type{anyList, numberType}, Result: anyType},
+		"slice":   FuncType{Params: []Type{anyList, numberType, numberType}, Result: anyList},
+		"cons":    FuncType{Params: []Type{anyType, anyList}, Result: anyList},
+		"concat":  FuncType{Params: []Type{anyList, anyList}, Result: anyList},
+		"zip":     FuncType{Params: []Type{anyList, anyList}, Result: anyList},
+		"range":   FuncType{Params: []Type{numberType, numberType}, Result: ListType{Elem: numberType}},
+		"map":     FuncType{Params: []Type{unaryFunc, anyList}, Result: anyList},
+		"filter":  FuncType{Params: []Type{unaryFunc, anyList}, Result: anyList},
+		"find":    FuncType{Params: []Type{unaryFunc, anyList}, Result: anyType},
+		"any?":    FuncType{Params: []Type{unaryFunc, anyList}, Result: booleanType},
+		"all?":    FuncType{Params: []Type{unaryFunc, anyList}, Result: booleanType},
+		"sort-by": FuncType{Params: []Type{unaryFunc, anyList}, Result: anyList},
+		"reduce": FuncType{
+			Params: []Type{FuncType{Params: []Type{anyType, anyType}, Result: anyType}, anyType, anyList},
+			Result: anyType,
+		},
+	}
+
+	return NewBuiltinModule(ListModuleName, values, types)
+}
@@ -0,0 +1,337 @@
+package kernel
+
+import (
+	"fmt"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+// map module, maps are never mutated, keys are listed in sorted order
+
+const MapModuleName = "map"
+
+func init() {
+	RegisterBuiltinModule(newMapModule())
+}
+
+func copyMap(m map[string]Exp) map[string]Exp {
+	newM := make(map[string]Exp, len(m))
+	for name, val := range m {
+		newM[name] = val
+	}
+	return newM
+}
+
+// path is a list of keys, strings for maps and integers for lists
+func toPath(v Exp) ([]Exp, error) {
+	path, err := engine.ToList(v)
+	if err != nil {
+		return nil, fmt.Errorf("path should be a list, but found %s", v.String())
+	}
+	return path, nil
+}
+
+// child of val at key, ok is false if it is missing
+func getChild(val Exp, key Exp) (Exp, bool, error) {
+	switch val.Kind() {
+	case engine.MapValue:
+		name, err := engine.ToString(key)
+		if err != nil {
+			return nil, false, fmt.Errorf("map key should be a string, but found %s", key.String())
+		}
+		m, _ := engine.ToMap(val)
+		child, ok := m[name]
+		return child, ok, nil
+	case engine.ListValue:
+		i, err := toIndex(key)
+		if err != nil {
+			return nil, false, fmt.Errorf("list index should be an integer, but found %s", key.String())
+		}
+		l, _ := engine.ToList(val)
+		if i < 0 || i >= len(l) {
+			return nil, false, nil
+		}
+		return l[i], true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+func setChild(val Exp, key Exp, child Exp) (Exp, error) {
+	switch val.Kind() {
+	case engine.ListValue:
+		i, err := toIndex(key)
+		if err != nil {
+			return nil, fmt.Errorf("list index should be an integer, but found %s", key.String())
+		}
+		l, _ := engine.ToList(val)
+		if i < 0 || i >= len(l) {
+			return nil, fmt.Errorf("index out of range: %d, length is %d", i, len(l))
+		}
+		newL := make([]Exp, len(l))
+		copy(newL, l)
+		newL[i] = child
+		return engine.NewList(newL), nil
+	case engine.MapValue, engine.NullValue:
+		name, err := engine.ToString(key)
+		if err != nil {
+			return nil, fmt.Errorf("map key should be a string, but found %s", key.String())
+		}
+		// missing map is created
+		var newM map[string]Exp
+		if m, err := engine.ToMap(val); err == nil {
+			newM = copyMap(m)
+		} else {
+			newM = make(map[string]Exp, 1)
+		}
+		newM[name] = child
+		return engine.NewMap(newM), nil
+	default:
+		return nil, fmt.Errorf("cannot set %s in %s", key.String(), val.String())
+	}
+}
+
+func getIn(val Exp, path []Exp) (Exp, bool, error) {
+	for _, key := range path {
+		child, ok, err := getChild(val, key)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		val = child
+	}
+	return val, true, nil
+}
+
+// updateIn replaces the value at path with f(old), old is null if missing
+func updateIn(val Exp, path []Exp, f func(old Exp) (Exp, error)) (Exp, error) {
+	if len(path) == 0 {
+		return f(val)
+	}
+
+	child, ok, err := getChild(val, path[0])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		child = engine.NewNull()
+	}
+	newChild, err := updateIn(child, path[1:], f)
+	if err != nil {
+		return nil, err
+	}
+	return setChild(val, path[0], newChild)
+}
+
+func deepMerge(m1, m2 map[string]Exp) map[string]Exp {
+	newM := copyMap(m1)
+	for name, val2 := range m2 {
+		val1, ok := newM[name]
+		if ok && val1.Kind() == engine.MapValue && val2.Kind() == engine.MapValue {
+			sub1, _ := engine.ToMap(val1)
+			sub2, _ := engine.ToMap(val2)
+			newM[name] = engine.NewMap(deepMerge(sub1, sub2))
+		} else {
+			newM[name] = val2
+		}
+	}
+	return newM
+}
+
+func mapFunc1(f func(m map[string]Exp) (Exp, error)) Exp {
+	return NewPrimitive(1, func(vals []Exp) (Exp, error) {
+		m, err := engine.ToMap(vals[0])
+		if err != nil {
+			return nil, err
+		}
+		return f(m)
+	})
+}
+
+func mapFunc2(f func(m1, m2 map[string]Exp) (Exp, error)) Exp {
+	return NewPrimitive(2, func(vals []Exp) (Exp, error) {
+		m1, err := engine.ToMap(vals[0])
+		if err != nil {
+			return nil, err
+		}
+		m2, err := engine.ToMap(vals[1])
+		if err != nil {
+			return nil, err
+		}
+		return f(m1, m2)
+	})
+}
+
+func getOr(val Exp, path []Exp, dflt Exp) (Exp, error) {
+	child, ok, err := getIn(val, path)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return dflt, nil
+	}
+	return child, nil
+}
+
+func newMapModule() *Module {
+	values := map[string]Exp{
+		// get and get-in give null if missing
+		"get": NewPrimitive(2, func(vals []Exp) (Exp, error) {
+			return getOr(vals[0], []Exp{vals[1]}, engine.NewNull())
+		}),
+		"get-or": NewPrimitive(3, func(vals []Exp) (Exp, error) {
+			return getOr(vals[0], []Exp{vals[1]}, vals[2])
+		}),
+		"get-in": NewPrimitive(2, func(vals []Exp) (Exp, error) {
+			path, err := toPath(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			return getOr(vals[0], path, engine.NewNull())
+		}),
+		"get-in-or": NewPrimitive(3, func(vals []Exp) (Exp, error) {
+			path, err := toPath(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			return getOr(vals[0], path, vals[2])
+		}),
+		"has?": NewPrimitive(2, func(vals []Exp) (Exp, error) {
+			_, ok, err := getChild(vals[0], vals[1])
+			if err != nil {
+				return nil, err
+			}
+			return engine.NewBoolean(ok), nil
+		}),
+		"assoc": NewPrimitive(3, func(vals []Exp) (Exp, error) {
+			if _, err := engine.ToMap(vals[0]); err != nil {
+				return nil, err
+			}
+			return setChild(vals[0], vals[1], vals[2])
+		}),
+		// missing maps on the path are created
+		"assoc-in": NewPrimitive(3, func(vals []Exp) (Exp, error) {
+			path, err := toPath(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			return updateIn(vals[0], path, func(Exp) (Exp, error) {
+				return vals[2], nil
+			})
+		}),
+		"dissoc": NewPrimitive(2, func(vals []Exp) (Exp, error) {
+			m, err := engine.ToMap(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			name, err := engine.ToString(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			newM := copyMap(m)
+			delete(newM, name)
+			return engine.NewMap(newM), nil
+		}),
+		// [map, key, f], f is called with the old value, null if missing
+		"update": NewCallPrimitive(3, func(call CallContext, vals []Exp) (Exp, error) {
+			if _, err := engine.ToMap(vals[0]); err != nil {
+				return nil, err
+			}
+			return updateIn(vals[0], []Exp{vals[1]}, func(old Exp) (Exp, error) {
+				return call.Apply(vals[2], old)
+			})
+		}),
+		"update-in": NewCallPrimitive(3, func(call CallContext, vals []Exp) (Exp, error) {
+			path, err := toPath(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			return updateIn(vals[0], path, func(old Exp) (Exp, error) {
+				return call.Apply(vals[2], old)
+			})
+		}),
+		"keys": mapFunc1(func(m map[string]Exp) (Exp, error) {
+			keys := engine.SortedKeys(m)
+			l := make([]Exp, len(keys))
+			for i, name := range keys {
+				l[i] = engine.NewString(name)
+			}
+			return engine.NewList(l), nil
+		}),
+		"vals": mapFunc1(func(m map[string]Exp) (Exp, error) {
+			keys := engine.SortedKeys(m)
+			l := make([]Exp, len(keys))
+			for i, name := range keys {
+				l[i] = m[name]
+			}
+			return engine.NewList(l), nil
+		}),
+		// [[key, value], ...]
+		"entries": mapFunc1(func(m map[string]Exp) (Exp, error) {
+			keys := engine.SortedKeys(m)
+			l := make([]Exp, len(keys))
+			for i, name := range keys {
+				l[i] = engine.NewList([]Exp{engine.NewString(name), m[name]})
+			}
+			return engine.NewList(l), nil
+		}),
+		// values of the second map win
+		"merge": mapFunc2(func(m1, m2 map[string]Exp) (Exp, error) {
+			newM := copyMap(m1)
+			for name, val := range m2 {
+				newM[name] = val
+			}
+			return engine.NewMap(newM), nil
+		}),
+		// nested maps are merged, other values of the second map win
+		"deep-merge": mapFunc2(func(m1, m2 map[string]Exp) (Exp, error) {
+			return engine.NewMap(deepMerge(m1, m2)), nil
+		}),
+		"select-keys": NewPrimitive(2, func(vals []Exp) (Exp, error) {
+			m, err := engine.ToMap(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			keys, err := engine.ToList(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			newM := make(map[string]Exp, len(keys))
+			for _, key := range keys {
+				name, err := engine.ToString(key)
+				if err != nil {
+					return nil, fmt.Errorf("map key should be a string, but found %s", key.String())
+				}
+				if val, ok := m[name]; ok {
+					newM[name] = val
+				}
+			}
+			return engine.NewMap(newM), nil
+		}),
+	}
+
+	var (
+		anyMap    = MapType{Elem: anyType}
+		anyList   = ListType{Elem: anyType}
+		unaryFunc = FuncType{Params: []Type{anyType}, Result: anyType}
+	)
+	types := map[string]Type{
+		"get":         FuncType{Params: []Type{anyType, anyType}, Result: anyType},
+		"get-or":      FuncType{Params: []Type{anyType, anyType, anyType}, Result: anyType},
+		"get-in":      FuncType{Params: []Type{anyType, anyList}, Result: anyType},
+		"get-in-or":   FuncType{Params: []Type{anyType, anyList, anyType}, Result: anyType},
+		"has?":        FuncType{Params: []Type{anyType, anyType}, Result: booleanType},
+		"assoc":       FuncType{Params: []Type{anyMap, stringType, anyType}, Result: anyMap},
+		"assoc-in":    FuncType{Params: []Type{anyType, anyList, anyType}, Result: anyType},
+		"dissoc":      FuncType{Params: []Type{anyMap, stringType}, Result: anyMap},
+		"update":      FuncType{Params: []Type{anyMap, stringType, unaryFunc}, Result: anyMap},
+		"update-in":   FuncType{Params: []Type{anyType, anyList, unaryFunc}, Result: anyType},
+		"keys":        FuncType{Params: []Type{anyMap}, Result: ListType{Elem: stringType}},
+		"vals":        FuncType{Params: []Type{anyMap}, Result: anyList},
+		"entries":     FuncType{Params: []Type{anyMap}, Result: anyList},
+		"merge":       FuncType{Params: []Type{anyMap, anyMap}, Result: anyMap},
+		"deep-merge":  FuncType{Params: []Type{anyMap, anyMap}, Result: anyMap},
+		"select-keys": FuncType{Params: []Type{anyMap, ListType{Elem: stringType}}, Result: anyMap},
+	}
+
+	return NewBuiltinModule(MapModuleName, values, types)
+}
@@ -0,0 +1,159 @@
+package kernel
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+// math module
+
+const MathModuleName = "math"
+
+func init() {
+	RegisterBuiltinModule(newMathModule())
+}
+
+func numberFunc1(f func(Exp) (Exp, error)) Exp {
+	return NewPrimitive(1, func(vals []Exp) (Exp, error) {
+		return f(vals[0])
+	})
+}
+
+func numberFunc2(f func(Exp, Exp) (Exp, error)) Exp {
+	return NewPrimitive(2, func(vals []Exp) (Exp, error) {
+		return f(vals[0], vals[1])
+	})
+}
+
+// powers are charged before they are computed, decimals are rounded with the decimal context of the call
+func powNumber() Exp {
+	return NewCallPrimitive(2, func(call CallContext, vals []Exp) (Exp, error) {
+		if err := call.Reserve(engine.NumberValue, engine.PowDigits(vals[0], vals[1])); err != nil {
+			return nil, err
+		}
+		return engine.PowNumberWith(vals[0], vals[1], engine.GetDecimalContext(call.Context()))
+	})
+}
+
+// float function, defined when inDomain, or everywhere if inDomain is nil
+func floatFunc1(name string, f func(float64) float64, inDomain func(float64) bool) Exp {
+	return NewPrimitive(1, func(vals []Exp) (Exp, error) {
+		x, err := engine.ToNumber(vals[0])
+		if err != nil {
+			return nil, err
+		}
+		if inDomain != nil && !inDomain(x) {
+			return nil, fmt.Errorf("%s: %s is out of domain", name, vals[0].String())
+		}
+		return engine.NewFloat(f(x)), nil
+	})
+}
+
+func positive(x float64) bool {
+	return x > 0
+}
+
+func inUnitRange(x float64) bool {
+	return x >= -1 && x <= 1
+}
+
+// min and max give one of their arguments, unchanged
+func selectNumber(less bool) Exp {
+	return NewVariadicPrimitive(Arity{Min: 1, Max: Variadic}, func(vals []Exp) (Exp, error) {
+		selected := vals[0]
+		if _, err := engine.ToNumeric(selected); err != nil {
+			return nil, err
+		}
+		for _, val := range vals[1:] {
+			c, err := engine.CompareNumber(selected, val)
+			if err != nil {
+				return nil, err
+			}
+			if (less && c > 0) || (!less && c < 0) {
+				selected = val
+			}
+		}
+		return selected, nil
+	})
+}
+
+func numberPredicate(f func(Exp) bool) Exp {
+	return NewPrimitive(1, func(vals []Exp) (Exp, error) {
+		if _, err := engine.ToNumeric(vals[0]); err != nil {
+			return nil, err
+		}
+		return engine.NewBoolean(f(vals[0])), nil
+	})
+}
+
+func newMathModule() *Module {
+	values := map[string]Exp{
+		"pi":  engine.NewFloat(math.Pi),
+		"e":   engine.NewFloat(math.E),
+		"inf": engine.NewFloat(math.Inf(1)),
+
+		"abs":   numberFunc1(engine.AbsNumber),
+		"floor": numberFunc1(engine.FloorNumber),
+		"ceil":  numberFunc1(engine.CeilNumber),
+		"round": numberFunc1(engine.RoundNumber),
+		"trunc": numberFunc1(engine.TruncNumber),
+		"sqrt":  numberFunc1(engine.SqrtNumber),
+		"quot":  numberFunc2(engine.QuoNumber),
+		"mod":   numberFunc2(engine.ModNumber),
+		"pow":   powNumber(),
+		"min":   selectNumber(true),
+		"max":   selectNumber(false),
+
+		"exp":   floatFunc1("exp", math.Exp, nil),
+		"log":   floatFunc1("log", math.Log, positive),
+		"log2":  floatFunc1("log2", math.Log2, positive),
+		"log10": floatFunc1("log10", math.Log10, positive),
+		"sin":   floatFunc1("sin", math.Sin, nil),
+		"cos":   floatFunc1("cos", math.Cos, nil),
+		"tan":   floatFunc1("tan", math.Tan, nil),
+		"asin":  floatFunc1("asin", math.Asin, inUnitRange),
+		"acos":  floatFunc1("acos", math.Acos, inUnitRange),
+		"atan":  floatFunc1("atan", math.Atan, nil),
+		"atan2": NewPrimitive(2, func(vals []Exp) (Exp, error) {
+			y, err := engine.ToNumber(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			x, err := engine.ToNumber(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			return engine.NewFloat(math.Atan2(y, x)), nil
+		}),
+
+		"inf?": numberPredicate(engine.IsInf),
+		"nan?": numberPredicate(engine.IsNaN),
+
+		"bit-and":     numberFunc2(engine.BitAnd),
+		"bit-or":      numberFunc2(engine.BitOr),
+		"bit-xor":     numberFunc2(engine.BitXor),
+		"bit-not":     numberFunc1(engine.BitNot),
+		"shift-left":  numberFunc2(engine.ShiftLeft),
+		"shift-right": numberFunc2(engine.ShiftRight),
+	}
+
+	types := make(map[string]Type, len(values))
+	for name, val := range values {
+		switch arity, _ := funcArity(val); {
+		case val.Kind() == engine.NumberValue:
+			types[name] = numberType
+		case name == "inf?" || name == "nan?":
+			types[name] = FuncType{Params: []Type{numberType}, Result: booleanType}
+		case arity.Max == Variadic:
+			types[name] = numberOp(arity.Min, numberType)
+		case arity.Min == 1:
+			types[name] = FuncType{Params: []Type{numberType}, Result: numberType}
+		default:
+			types[name] = FuncType{Params: []Type{numberType, numberType}, Result: numberType}
+		}
+	}
+
+	return NewBuiltinModule(MathModuleName, values, types)
+}
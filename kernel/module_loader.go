@@ -1,6 +1,7 @@
 package kernel
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -11,9 +12,30 @@ import (
 
 // module
 
+var (
+	ErrModuleNotFound  = errors.New("Module Not Found")
+	ErrCircularLoading = errors.New("Circular Loading")
+)
+
+// ModuleError is an error of loading a module, Cause is the error in it
+type ModuleError struct {
+	Module string
+	Cause  error
+}
+
+func (e *ModuleError) Error() string {
+	return fmt.Sprintf("module %s: %s", e.Module, e.Cause.Error())
+}
+
+func (e *ModuleError) Unwrap() error {
+	return e.Cause
+}
+
 type ImportVal struct {
 	Value    Exp
 	Explicit bool
+	// static type, nil if unknown
+	Type Type
 }
 
 type LoadingState struct {
@@ -27,6 +49,9 @@ type Module struct {
 	Filename     string
 	ImportValues map[string]*ImportVal
 	ExportValues map[string]Exp
+	// typed module has type annotations, it is type checked before running
+	Typed        bool
+	ExportTypes  map[string]Type
 	loadingState *LoadingState
 }
 
@@ -61,29 +86,76 @@ const (
 	PreludeModuleName = "prelude"
 )
 
+// NewModuleTable makes a module table with only the prelude loaded
+func NewModuleTable() map[string]*Module {
+	return map[string]*Module{
+		preludeModule.Name: preludeModule,
+	}
+}
+
 func GetModuleTable(ctx Context) map[string]*Module {
 	v := ctx.Get(ModuleTableKey)
 	if v == nil {
-		mt := map[string]*Module{
-			preludeModule.Name: preludeModule,
-		}
+		mt := NewModuleTable()
 		ctx.Top().Set(ModuleTableKey, mt)
 		return mt
 	}
 	return v.(map[string]*Module)
 }
 
+// builtin module, implemented in go, importable without a module loader
+
+var builtinModules = make(map[string]*Module)
+
+func NewBuiltinModule(name string, values map[string]Exp, types map[string]Type) *Module {
+	return &Module{
+		Name:         name,
+		ImportValues: make(map[string]*ImportVal),
+		ExportValues: namePrimitives(values),
+		ExportTypes:  types,
+	}
+}
+
+// primitives are named by their export names, for error messages
+func namePrimitives(values map[string]Exp) map[string]Exp {
+	for name, val := range values {
+		if pri, err := ToPrimitive(val); err == nil && pri.Name == "" {
+			pri.Name = name
+			values[name] = pri
+		}
+	}
+	return values
+}
+
+// RegisterBuiltinModule makes module importable by its name, unless the module loader finds a module of the same name
+func RegisterBuiltinModule(module *Module) {
+	builtinModules[module.Name] = module
+}
+
+func GetBuiltinModule(name string) *Module {
+	return builtinModules[name]
+}
+
 func NewInitImportValues(module *Module) map[string]*ImportVal {
 	result := make(map[string]*ImportVal, len(module.ExportValues))
 	for name, val := range module.ExportValues {
 		result[name] = &ImportVal{
 			Value:    val,
 			Explicit: false,
+			Type:     module.ExportTypes[name],
 		}
 	}
 	return result
 }
 
+func preludeNames() []string {
+	names := make([]string, 0, len(preludeModule.ExportValues))
+	for name := range preludeModule.ExportValues {
+		names = append(names, name)
+	}
+	return names
+}
+
 func GetInitImportValues(ctx Context) (map[string]*ImportVal, error) {
 	mt := GetModuleTable(ctx)
 	preludeModule := mt[PreludeModuleName]
@@ -141,7 +213,7 @@ func (loader *FileModuleLoader) NormalizeModuleName(ctx Context, moduleName stri
 		return name, filename, nil
 	}
 
-	return "", "", fmt.Errorf("cannot find module %s in paths: %v", moduleName, loader.findPaths)
+	return "", "", fmt.Errorf("%w in paths: %v", ErrModuleNotFound, loader.findPaths)
 }
 
 func (loader *FileModuleLoader) ParseModule(ctx Context, moduleName, fileName string) (Exp, error) {
@@ -162,6 +234,9 @@ func (loader *FileModuleLoader) LoadModule(ctx Context, interp Interpreter, name
 	newCtx := ctx.Protect()
 	moduleName, fileName, err := loader.NormalizeModuleName(newCtx, name)
 	if err != nil {
+		return nil, &ModuleError{Module: name, Cause: err}
+	}
+	if err := checkModuleAllowed(newCtx, moduleName); err != nil {
 		return nil, err
 	}
 	// if module is loaded, return it
@@ -170,20 +245,20 @@ func (loader *FileModuleLoader) LoadModule(ctx Context, interp Interpreter, name
 		if m.IsLoaded() {
 			return m, nil
 		}
-		return nil, fmt.Errorf("error: circular loading module %q", moduleName)
+		return nil, &ModuleError{Module: moduleName, Cause: ErrCircularLoading}
 	}
 
 	// parse module
 	exp, err := loader.ParseModule(newCtx, moduleName, fileName)
 	if err != nil {
-		return nil, err
+		return nil, &ModuleError{Module: moduleName, Cause: err}
 	}
 
 	// evaluate module
 	newCtx = EnsureEvalLevel(newCtx, ModuleLevel)
 	newEnv := engine.NewEnv(nil)
 	if _, err := interp.Interpret(newCtx, exp, newEnv); err != nil {
-		return nil, err
+		return nil, &ModuleError{Module: moduleName, Cause: err}
 	}
 
 	module := mt[moduleName]
@@ -203,20 +278,26 @@ type SimpleModuleLoader struct {
 }
 
 func (loader *SimpleModuleLoader) LoadModule(ctx Context, interp Interpreter, name string) (*Module, error) {
+	if err := checkModuleAllowed(ctx, name); err != nil {
+		return nil, err
+	}
 	// if module is loaded, return it
 	mt := GetModuleTable(ctx)
 	if m, ok := mt[name]; ok {
 		if m.IsLoaded() {
 			return m, nil
 		}
-		return nil, fmt.Errorf("error: circular loading module %q", name)
+		return nil, &ModuleError{Module: name, Cause: ErrCircularLoading}
 	}
 
-	exp := loader.Modules[name]
+	exp, ok := loader.Modules[name]
+	if !ok {
+		return nil, &ModuleError{Module: name, Cause: ErrModuleNotFound}
+	}
 	newCtx := EnsureEvalLevel(ctx.Protect(), ModuleLevel)
 	newEnv := engine.NewEnv(nil)
 	if _, err := interp.Interpret(newCtx, exp, newEnv); err != nil {
-		return nil, err
+		return nil, &ModuleError{Module: name, Cause: err}
 	}
 
 	module := mt[name]
@@ -0,0 +1,432 @@
+package kernel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+// name checking, a pass before evaluation
+
+type NameError struct {
+	Module      string
+	Name        string
+	Ambiguous   bool
+	Suggestions []string
+}
+
+func (e *NameError) Error() string {
+	var msg string
+	if e.Ambiguous {
+		msg = fmt.Sprintf("%s: ambiguous name %q, imported implicitly from more than one module", e.Module, e.Name)
+	} else {
+		msg = fmt.Sprintf("%s: unbound name %q", e.Module, e.Name)
+	}
+	if len(e.Suggestions) != 0 {
+		quoted := make([]string, len(e.Suggestions))
+		for i, s := range e.Suggestions {
+			quoted[i] = fmt.Sprintf("%q", s)
+		}
+		msg += ", did you mean " + strings.Join(quoted, " or ") + "?"
+	}
+	return msg
+}
+
+// all name errors found in one pass
+type NameErrors []*NameError
+
+func (errs NameErrors) Error() string {
+	strs := make([]string, len(errs))
+	for i, err := range errs {
+		strs[i] = err.Error()
+	}
+	return strings.Join(strs, "\n")
+}
+
+type nameBinding uint8
+
+const (
+	boundName nameBinding = iota
+	// implicitly imported, may become ambiguous
+	implicitName
+	ambiguousName
+)
+
+type nameScope struct {
+	names  map[string]nameBinding
+	parent *nameScope
+}
+
+func newNameScope(parent *nameScope) *nameScope {
+	return &nameScope{
+		names:  make(map[string]nameBinding),
+		parent: parent,
+	}
+}
+
+func (s *nameScope) lookup(name string) (nameBinding, bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		if b, ok := sc.names[name]; ok {
+			return b, true
+		}
+	}
+	return boundName, false
+}
+
+func (s *nameScope) bind(name string) {
+	s.names[name] = boundName
+}
+
+func (s *nameScope) bindImplicit(name string) {
+	if b, ok := s.names[name]; ok {
+		if b == implicitName {
+			s.names[name] = ambiguousName
+		}
+		return
+	}
+	s.names[name] = implicitName
+}
+
+func (s *nameScope) visibleNames() []string {
+	seen := make(map[string]struct{})
+	var names []string
+	for sc := s; sc != nil; sc = sc.parent {
+		for name := range sc.names {
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+type nameChecker struct {
+	module string
+	errs   NameErrors
+}
+
+// CheckNames resolves every variable in exp against bound names, definitions,
+// function arguments and imports, and reports all unbound or ambiguous names.
+func CheckNames(exp Exp, bound []string) error {
+	scope := newNameScope(nil)
+	for _, name := range bound {
+		scope.bind(name)
+	}
+
+	checker := &nameChecker{module: "top level"}
+	scope = newNameScope(scope)
+	checker.collectDefs(exp, scope)
+	checker.check(exp, scope)
+	return checker.result()
+}
+
+// checkModuleNames checks a module body, prelude names are imported implicitly
+func checkModuleNames(moduleName string, importValues map[string]*ImportVal, body []Exp) error {
+	scope := newNameScope(nil)
+	for name := range importValues {
+		scope.bindImplicit(name)
+	}
+
+	checker := &nameChecker{module: moduleName}
+	scope = newNameScope(scope)
+	for _, subExp := range body {
+		checker.collectImports(subExp, scope)
+	}
+	for _, subExp := range body {
+		checker.collectDefs(subExp, scope)
+	}
+	for _, subExp := range body {
+		checker.check(subExp, scope)
+	}
+	return checker.result()
+}
+
+func (c *nameChecker) result() error {
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return c.errs
+}
+
+func (c *nameChecker) addError(name string, binding nameBinding, scope *nameScope) {
+	err := &NameError{
+		Module: c.module,
+		Name:   name,
+	}
+	if binding == ambiguousName {
+		err.Ambiguous = true
+	} else {
+		err.Suggestions = suggestNames(name, scope.visibleNames())
+	}
+	c.errs = append(c.errs, err)
+}
+
+func (c *nameChecker) resolve(name string, scope *nameScope) {
+	binding, ok := scope.lookup(name)
+	if !ok || binding == ambiguousName {
+		c.addError(name, binding, scope)
+	}
+}
+
+func (c *nameChecker) collectImports(exp Exp, scope *nameScope) {
+	r, err := engine.ToRedex(exp)
+	if err != nil || r.Name != "import" {
+		return
+	}
+	m, err := engine.ToMapExp(r.Exp)
+	if err != nil {
+		return
+	}
+
+	// explicit names override implicit ones
+	explicitNames := make(map[string]struct{})
+	for _, specExp := range m {
+		nameMap, err := importSpecToNameMap(specExp)
+		if err != nil {
+			continue
+		}
+		for _, importName := range nameMap {
+			if importName.explicit {
+				explicitNames[importName.name] = struct{}{}
+			} else {
+				scope.parent.bindImplicit(importName.name)
+			}
+		}
+	}
+	for name := range explicitNames {
+		scope.bind(name)
+	}
+}
+
+// collectDefs finds names defined in current scope, without entering nested scopes
+func (c *nameChecker) collectDefs(exp Exp, scope *nameScope) {
+	switch exp.Kind() {
+	case engine.ReducibleExp:
+		r, _ := engine.ToRedex(exp)
+		switch r.Name {
+		case "func", "block", "module":
+			return
+		case "def":
+			m, err := engine.ToMapExp(r.Exp)
+			if err != nil {
+				return
+			}
+			for name, subExp := range m {
+				scope.bind(name)
+				c.collectDefs(subExp, scope)
+			}
+			return
+		case "import":
+			// top level import defines names
+			if c.module != "top level" {
+				return
+			}
+			m, err := engine.ToMapExp(r.Exp)
+			if err != nil {
+				return
+			}
+			for _, specExp := range m {
+				nameMap, err := importSpecToNameMap(specExp)
+				if err != nil {
+					continue
+				}
+				for _, importName := range nameMap {
+					scope.bind(importName.name)
+				}
+			}
+			return
+		}
+		c.collectDefs(r.Exp, scope)
+	case engine.ListExp:
+		l, _ := engine.ToListExp(exp)
+		for _, subExp := range l {
+			c.collectDefs(subExp, scope)
+		}
+	case engine.MapExp:
+		m, _ := engine.ToMapExp(exp)
+		for _, subExp := range m {
+			c.collectDefs(subExp, scope)
+		}
+	}
+}
+
+func (c *nameChecker) check(exp Exp, scope *nameScope) {
+	switch exp.Kind() {
+	case engine.ReducibleExp:
+		r, _ := engine.ToRedex(exp)
+		c.checkRedex(r, scope)
+	case engine.SuspendExp:
+		s, _ := engine.ToSuspendExp(exp)
+		c.checkRedex(engine.UnsuspendExp(s), scope)
+	case engine.ListExp:
+		l, _ := engine.ToListExp(exp)
+		for _, subExp := range l {
+			c.check(subExp, scope)
+		}
+	case engine.MapExp:
+		m, _ := engine.ToMapExp(exp)
+		for _, subExp := range m {
+			c.check(subExp, scope)
+		}
+	}
+}
+
+func (c *nameChecker) checkRedex(r engine.Redex, scope *nameScope) {
+	switch r.Name {
+	case "var":
+		name, err := engine.ToString(r.Exp)
+		if err != nil {
+			return
+		}
+		c.resolve(name, scope)
+	case "func":
+		c.checkFunc(r.Exp, scope)
+	case "block":
+		newScope := newNameScope(scope)
+		c.collectDefs(r.Exp, newScope)
+		c.check(r.Exp, newScope)
+	case "set":
+		m, err := engine.ToMapExp(r.Exp)
+		if err != nil {
+			return
+		}
+		for name, subExp := range m {
+			c.resolve(name, scope)
+			c.check(subExp, scope)
+		}
+	case "module":
+		m, err := engine.ToMapExp(r.Exp)
+		if err != nil {
+			return
+		}
+		body, err := engine.ToListExp(m["body"])
+		if err != nil {
+			return
+		}
+		moduleName, _ := getStringValue(m, "name")
+		if err := checkModuleNames(moduleName, NewInitImportValues(preludeModule), body); err != nil {
+			c.errs = append(c.errs, err.(NameErrors)...)
+		}
+	case "import":
+		// names are collected before checking
+	case "export":
+		l, err := engine.ToListExp(r.Exp)
+		if err != nil {
+			return
+		}
+		for _, subExp := range l {
+			names := make(map[string]string)
+			if err := addExportNameToNameMap(subExp, names); err != nil {
+				continue
+			}
+			for _, name := range names {
+				c.resolve(name, scope)
+			}
+		}
+	default:
+		c.check(r.Exp, scope)
+	}
+}
+
+func (c *nameChecker) checkFunc(exp Exp, scope *nameScope) {
+	l, err := engine.ToListExp(exp)
+	if err != nil || len(l) < 2 {
+		return
+	}
+
+	newScope := newNameScope(scope)
+	argExps, _ := engine.ToListExp(l[0])
+	for _, argExp := range argExps {
+		if arg, _, err := funcArg(argExp); err == nil {
+			newScope.bind(arg)
+		}
+	}
+
+	if len(l) == 3 {
+		contracts, _ := engine.ToMapExp(l[2])
+		if pre, ok := contracts[PreContract]; ok {
+			c.check(pre, newScope)
+		}
+		if post, ok := contracts[PostContract]; ok {
+			postScope := newNameScope(newScope)
+			postScope.bind(ContractResultName)
+			c.check(post, postScope)
+		}
+	}
+
+	c.collectDefs(l[1], newScope)
+	c.check(l[1], newScope)
+}
+
+// suggestion
+
+// optimal string alignment distance, a transposition counts as one edit
+func editDistance(s, t string) int {
+	a, b := []rune(s), []rune(t)
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(minInt(d[i-1][j]+1, d[i][j-1]+1), d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func suggestNames(name string, candidates []string) []string {
+	maxDist := len(name) / 3
+	if maxDist < 1 {
+		maxDist = 1
+	}
+
+	type candidate struct {
+		name string
+		dist int
+	}
+	var found []candidate
+	for _, cand := range candidates {
+		d := editDistance(name, cand)
+		if d <= maxDist {
+			found = append(found, candidate{name: cand, dist: d})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].dist != found[j].dist {
+			return found[i].dist < found[j].dist
+		}
+		return found[i].name < found[j].name
+	})
+
+	if len(found) > 3 {
+		found = found[:3]
+	}
+	result := make([]string, len(found))
+	for i, cand := range found {
+		result[i] = cand.name
+	}
+	return result
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
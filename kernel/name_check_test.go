@@ -0,0 +1,83 @@
+package kernel
+
+import (
+	"testing"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+func TestCheckNames_Unbound(t *testing.T) {
+	e := mustParse(`{"begin": [
+		{"def": {
+		  "fact": {"func": [["n"],
+					 {"if": [["<=", "n", 0],
+							 1,
+							 ["*", "m", ["fatc", ["-", "n", 1]]]]}
+				  ]}
+		}},
+		["fact", 5]
+	]}`)
+
+	err := CheckNames(e, preludeNames())
+	errs, ok := err.(NameErrors)
+	if !ok {
+		t.Fatalf("expect name errors, but found %v", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expect 2 name errors, but found %s", errs.Error())
+	}
+
+	for _, nerr := range errs {
+		if nerr.Name == "fatc" {
+			if len(nerr.Suggestions) == 0 || nerr.Suggestions[0] != "fact" {
+				t.Fatalf("expect suggestion fact, but found %v", nerr.Suggestions)
+			}
+		} else if nerr.Name != "m" {
+			t.Fatalf("unexpected name error: %s", nerr.Error())
+		}
+	}
+
+	// nothing is evaluated
+	if _, err := interp(e); err == nil {
+		t.Fatal("expect name errors")
+	}
+}
+
+func TestCheckNames_Module(t *testing.T) {
+	e := mustNewModule("m", `
+		{"import": {"fact": ["factIter"]}}
+		{"def": {"fact": {"func": [["n"], {"post": [">", "result", 0]}, ["factIter", "n", 1]]}}}
+		{"export": ["fact", "fact2"]}`)
+
+	err := CheckNames(e, nil)
+	errs, ok := err.(NameErrors)
+	if !ok || len(errs) != 1 || errs[0].Name != "fact2" {
+		t.Fatalf("expect fact2 unbound, but found %v", err)
+	}
+}
+
+func TestCheckNames_Ambiguous(t *testing.T) {
+	// factIter is imported implicitly as "+", which conflicts with prelude
+	importExp := engine.NewRedex("import", engine.NewMapExp(map[string]Exp{
+		"fact": engine.NewListExp([]Exp{
+			engine.NewListExp([]Exp{engine.NewString("factIter"), engine.NewString("+"), engine.NewBoolean(false)}),
+		}),
+	}))
+
+	err := checkModuleNames("m", NewInitImportValues(preludeModule), []Exp{
+		importExp,
+		mustParse(`["decimal", ["-", 1, 2]]`),
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = checkModuleNames("m", NewInitImportValues(preludeModule), []Exp{
+		importExp,
+		mustParse(`["decimal", ["+", 1, 2]]`),
+	})
+	errs, ok := err.(NameErrors)
+	if !ok || len(errs) != 1 || !errs[0].Ambiguous {
+		t.Fatalf("expect ambiguous name +, but found %v", err)
+	}
+}
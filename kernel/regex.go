@@ -0,0 +1,248 @@
+package kernel
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+// regex module, patterns use go regexp syntax
+
+const RegexModuleName = "regex"
+
+func init() {
+	RegisterBuiltinModule(newRegexModule())
+}
+
+// compiled regexes, by pattern, the least recently used are evicted beyond maxCachedRegexes
+const maxCachedRegexes = 256
+
+var regexCache = newRegexLRU(maxCachedRegexes)
+
+type regexEntry struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+type regexLRU struct {
+	mu    sync.Mutex
+	max   int
+	order *list.List
+	items map[string]*list.Element
+}
+
+func newRegexLRU(max int) *regexLRU {
+	return &regexLRU{
+		max:   max,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *regexLRU) get(pattern string) (*regexp.Regexp, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[pattern]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*regexEntry).re, true
+}
+
+// add gives the cached regex if pattern is added concurrently
+func (c *regexLRU) add(pattern string, re *regexp.Regexp) *regexp.Regexp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[pattern]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*regexEntry).re
+	}
+	c.items[pattern] = c.order.PushFront(&regexEntry{pattern: pattern, re: re})
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*regexEntry).pattern)
+	}
+	return re
+}
+
+func (c *regexLRU) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func CompileRegex(pattern string) (Regex, error) {
+	if re, ok := regexCache.get(pattern); ok {
+		return NewRegex(re), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Regex{}, fmt.Errorf("invalid regex %q: %s", pattern, err.Error())
+	}
+	return NewRegex(regexCache.add(pattern, re)), nil
+}
+
+// regex value, or a string pattern
+func toRegexp(v Exp) (*regexp.Regexp, error) {
+	if re, err := ToRegex(v); err == nil {
+		return re.Regexp, nil
+	}
+	pattern, err := engine.ToString(v)
+	if err != nil {
+		return nil, fmt.Errorf("expect regex, but found %s", v.String())
+	}
+	re, err := CompileRegex(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.Regexp, nil
+}
+
+func hasNamedGroups(re *regexp.Regexp) bool {
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// match is the matched string if there is no group,
+// a map of named groups if there are named groups,
+// otherwise a list of the matched string and the groups.
+// unmatched groups are null.
+func matchValue(re *regexp.Regexp, s string, loc []int) Exp {
+	group := func(i int) Exp {
+		if loc[2*i] < 0 {
+			return engine.NewNull()
+		}
+		return engine.NewString(s[loc[2*i]:loc[2*i+1]])
+	}
+
+	if re.NumSubexp() == 0 {
+		return group(0)
+	}
+	if hasNamedGroups(re) {
+		m := make(map[string]Exp)
+		for i, name := range re.SubexpNames() {
+			if name != "" {
+				m[name] = group(i)
+			}
+		}
+		return engine.NewMap(m)
+	}
+	l := make([]Exp, re.NumSubexp()+1)
+	for i := range l {
+		l[i] = group(i)
+	}
+	return engine.NewList(l)
+}
+
+func regexFunc(f func(re *regexp.Regexp, s string) (Exp, error)) Exp {
+	return NewPrimitive(2, func(vals []Exp) (Exp, error) {
+		re, err := toRegexp(vals[0])
+		if err != nil {
+			return nil, err
+		}
+		s, err := engine.ToString(vals[1])
+		if err != nil {
+			return nil, err
+		}
+		return f(re, s)
+	})
+}
+
+func replaceRegex(call CallContext, re *regexp.Regexp, s string, replacer Exp) (Exp, error) {
+	// $1 and ${name} in replacement string are expanded
+	if repl, err := engine.ToString(replacer); err == nil {
+		return engine.NewString(re.ReplaceAllString(s, repl)), nil
+	}
+
+	var (
+		result []byte
+		last   int
+	)
+	for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+		val, err := call.Apply(replacer, matchValue(re, s, loc))
+		if err != nil {
+			return nil, err
+		}
+		repl, err := engine.ToString(val)
+		if err != nil {
+			return nil, call.Errorf("replacer should return string, but found %s", val.String())
+		}
+		result = append(result, s[last:loc[0]]...)
+		result = append(result, repl...)
+		last = loc[1]
+	}
+	result = append(result, s[last:]...)
+	return engine.NewString(string(result)), nil
+}
+
+func newRegexModule() *Module {
+	values := map[string]Exp{
+		"regex": NewPrimitive(1, func(vals []Exp) (Exp, error) {
+			pattern, err := engine.ToString(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			return CompileRegex(pattern)
+		}),
+		"re-match?": regexFunc(func(re *regexp.Regexp, s string) (Exp, error) {
+			return engine.NewBoolean(re.MatchString(s)), nil
+		}),
+		// first match, null if not found
+		"re-find": regexFunc(func(re *regexp.Regexp, s string) (Exp, error) {
+			loc := re.FindStringSubmatchIndex(s)
+			if loc == nil {
+				return engine.NewNull(), nil
+			}
+			return matchValue(re, s, loc), nil
+		}),
+		"re-find-all": regexFunc(func(re *regexp.Regexp, s string) (Exp, error) {
+			locs := re.FindAllStringSubmatchIndex(s, -1)
+			l := make([]Exp, len(locs))
+			for i, loc := range locs {
+				l[i] = matchValue(re, s, loc)
+			}
+			return engine.NewList(l), nil
+		}),
+		"re-split": regexFunc(func(re *regexp.Regexp, s string) (Exp, error) {
+			parts := re.Split(s, -1)
+			l := make([]Exp, len(parts))
+			for i, part := range parts {
+				l[i] = engine.NewString(part)
+			}
+			return engine.NewList(l), nil
+		}),
+		// [regex, string, replacer], replacer is a string or a function called with each match
+		"re-replace": NewCallPrimitive(3, func(call CallContext, vals []Exp) (Exp, error) {
+			re, err := toRegexp(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			s, err := engine.ToString(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			return replaceRegex(call, re, s, vals[2])
+		}),
+	}
+
+	types := map[string]Type{
+		"regex":       FuncType{Params: []Type{stringType}, Result: anyType},
+		"re-match?":   FuncType{Params: []Type{anyType, stringType}, Result: booleanType},
+		"re-find":     FuncType{Params: []Type{anyType, stringType}, Result: anyType},
+		"re-find-all": FuncType{Params: []Type{anyType, stringType}, Result: ListType{Elem: anyType}},
+		"re-split":    FuncType{Params: []Type{anyType, stringType}, Result: ListType{Elem: stringType}},
+		"re-replace":  FuncType{Params: []Type{anyType, stringType, anyType}, Result: stringType},
+	}
+
+	return NewBuiltinModule(RegexModuleName, values, types)
+}
@@ -10,6 +10,11 @@ type Repl struct {
 	parser       engine.Parser
 	interpreter  engine.Interpreter
 	moduleLoader ModuleLoader
+	contracts    bool
+	// program io, os streams if nil
+	stdout io.Writer
+	stderr io.Writer
+	stdin  io.Reader
 }
 
 func NewRepl(parser engine.Parser, interp engine.Interpreter, moduleLoader ModuleLoader) *Repl {
@@ -17,6 +22,7 @@ func NewRepl(parser engine.Parser, interp engine.Interpreter, moduleLoader Modul
 		parser:       parser,
 		interpreter:  interp,
 		moduleLoader: moduleLoader,
+		contracts:    true,
 	}
 }
 
@@ -24,7 +30,9 @@ func (d *Repl) EvalBatch(filename string) error {
 	ctx := engine.NewContext(map[string]interface{}{
 		EvalLevelKey:    ModuleLevel,
 		ModuleLoaderKey: d.moduleLoader,
+		ContractsKey:    d.contracts,
 	})
+	d.setStreams(ctx)
 	_, err := d.moduleLoader.LoadModule(ctx, d.interpreter, filename)
 	return err
 }
@@ -38,10 +46,35 @@ func (d *Repl) EvalInteractive(exp Exp) (Exp, error) {
 	ctx := engine.NewContext(map[string]interface{}{
 		EvalLevelKey:    TopLevel,
 		ModuleLoaderKey: d.moduleLoader,
+		ContractsKey:    d.contracts,
 	})
+	d.setStreams(ctx)
 
-	env := engine.NewEnv(preludeModule.ExportValues).Protect()
-	return d.interpreter.Interpret(ctx, exp, env)
+	return EvalTopLevel(ctx, d.interpreter, exp, make(map[string]Exp))
+}
+
+// EvalTopLevel checks and evaluates exp at top level, in globals over the prelude.
+// top level definitions and imports are added to globals.
+func EvalTopLevel(ctx Context, interp Interpreter, exp Exp, globals map[string]Exp) (Exp, error) {
+	names := preludeNames()
+	types := preludeTypeEnv()
+	for name := range globals {
+		names = append(names, name)
+		types[name] = anyType
+	}
+
+	if err := CheckNames(exp, names); err != nil {
+		return nil, err
+	}
+	if IsTyped(exp) {
+		if _, err := CheckTypes("top level", []Exp{exp}, types); err != nil {
+			return nil, err
+		}
+	}
+
+	// prelude is shared by the process, set only changes a copy of it
+	env := engine.NewEnv(preludeModule.ExportValues).Protect().Extend(globals)
+	return interp.Interpret(ctx, exp, env)
 }
 
 func (d *Repl) AddPaths(paths []string) {
@@ -52,3 +85,35 @@ func (d *Repl) AddPaths(paths []string) {
 		loader.SetFindPaths(findPaths)
 	}
 }
+
+// turn off contracts checking for speed
+func (d *Repl) SetContracts(enabled bool) {
+	d.contracts = enabled
+}
+
+func (d *Repl) setStreams(ctx Context) {
+	if d.stdout != nil {
+		ctx.Set(StdoutKey, d.stdout)
+	}
+	if d.stderr != nil {
+		ctx.Set(StderrKey, d.stderr)
+	}
+	if d.stdin != nil {
+		ctx.Set(StdinKey, d.stdin)
+	}
+}
+
+// programs write to w instead of os.Stdout
+func (d *Repl) SetStdout(w io.Writer) {
+	d.stdout = w
+}
+
+// programs write errors to w instead of os.Stderr
+func (d *Repl) SetStderr(w io.Writer) {
+	d.stderr = w
+}
+
+// programs read from r instead of os.Stdin
+func (d *Repl) SetStdin(r io.Reader) {
+	d.stdin = r
+}
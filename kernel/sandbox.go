@@ -0,0 +1,109 @@
+package kernel
+
+import (
+	"fmt"
+)
+
+// sandbox restricts importable modules and capabilities of primitives,
+// evaluation is unrestricted if there is no sandbox in context
+
+// capabilities of primitives with side effects, pure primitives need none
+const (
+	IOCapability     = "io"
+	TimeCapability   = "time"
+	RandomCapability = "random"
+	EnvCapability    = "env"
+)
+
+const SandboxKey = "sandbox"
+
+type Sandbox struct {
+	// allowed modules, nil if all modules are allowed.
+	// imports in allowed modules are checked too, so modules they import have to be listed as well.
+	modules map[string]bool
+	// allowed capabilities, nil if all capabilities are allowed
+	capabilities map[string]bool
+}
+
+func allowSet(names []string) map[string]bool {
+	if names == nil {
+		return nil
+	}
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// NewSandbox makes a sandbox of allowlists, a nil allowlist allows all, an empty one allows none
+func NewSandbox(modules, capabilities []string) *Sandbox {
+	return &Sandbox{
+		modules:      allowSet(modules),
+		capabilities: allowSet(capabilities),
+	}
+}
+
+// AllowModule tells if module can be imported, prelude is always allowed
+func (s *Sandbox) AllowModule(name string) bool {
+	return s == nil || s.modules == nil || name == PreludeModuleName || s.modules[name]
+}
+
+func (s *Sandbox) AllowCapability(capability string) bool {
+	return s == nil || s.capabilities == nil || s.capabilities[capability]
+}
+
+// SandboxError is returned when a module or a capability is denied
+type SandboxError struct {
+	// module or capability
+	Denied string
+	Name   string
+	// primitive requiring the capability
+	Primitive string
+}
+
+func (e *SandboxError) Error() string {
+	if e.Primitive != "" {
+		return fmt.Sprintf("sandbox denied %s %q to %s", e.Denied, e.Name, e.Primitive)
+	}
+	return fmt.Sprintf("sandbox denied %s %q", e.Denied, e.Name)
+}
+
+func GetSandbox(ctx Context) *Sandbox {
+	v := ctx.Get(SandboxKey)
+	if v == nil {
+		return nil
+	}
+	return v.(*Sandbox)
+}
+
+func checkModuleAllowed(ctx Context, name string) error {
+	if s := GetSandbox(ctx); s != nil && !s.AllowModule(name) {
+		return &SandboxError{Denied: "module", Name: name}
+	}
+	return nil
+}
+
+func checkCapability(ctx Context, pri PrimitiveFunc) error {
+	if pri.Capability == "" {
+		return nil
+	}
+	if s := GetSandbox(ctx); s != nil && !s.AllowCapability(pri.Capability) {
+		name := pri.Name
+		if name == "" {
+			name = "primitive"
+		}
+		return &SandboxError{Denied: "capability", Name: pri.Capability, Primitive: name}
+	}
+	return nil
+}
+
+// WithCapability makes primitive pri require capability
+func WithCapability(capability string, pri Exp) Exp {
+	p, err := ToPrimitive(pri)
+	if err != nil {
+		panic(err.Error())
+	}
+	p.Capability = capability
+	return p
+}
@@ -0,0 +1,56 @@
+package kernel
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+func TestSandbox(t *testing.T) {
+	eval := func(sandbox *Sandbox, src string) (Exp, error) {
+		ctx := engine.NewContext(map[string]interface{}{
+			EvalLevelKey: TopLevel,
+			StdoutKey:    &bytes.Buffer{},
+			SandboxKey:   sandbox,
+		})
+		return EvalTopLevel(ctx, NewKernelInterpreter(), mustParse(src), make(map[string]Exp))
+	}
+
+	printing := `{"begin": [{"import": {"io": ["print"]}}, ["print", 1]]}`
+	if _, err := eval(NewSandbox(nil, nil), printing); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := eval(NewSandbox([]string{"io"}, []string{IOCapability}), printing); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err := eval(NewSandbox([]string{"io"}, []string{}), printing)
+	if e := (*SandboxError)(nil); !errors.As(err, &e) || e.Denied != "capability" || e.Name != IOCapability || e.Primitive != "print" {
+		t.Fatalf("expect io capability denied, but found %v", err)
+	}
+	_, err = eval(NewSandbox([]string{"math"}, nil), printing)
+	if e := (*SandboxError)(nil); !errors.As(err, &e) || e.Denied != "module" || e.Name != "io" {
+		t.Fatalf("expect io module denied, but found %v", err)
+	}
+
+	// pure code needs nothing
+	val, err := eval(NewSandbox([]string{}, []string{}), `["+", 1, 2]`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "3" {
+		t.Fatalf("expect 3, but found %s", val.String())
+	}
+
+	for _, name := range []string{"time", "random", "env"} {
+		if _, ok := preludeModule.ExportValues[name]; ok {
+			t.Fatalf("expect %s not in prelude", name)
+		}
+	}
+	_, err = eval(NewSandbox(nil, []string{IOCapability}), `{"begin": [{"import": {"random": ["random"]}}, ["random"]]}`)
+	if e := (*SandboxError)(nil); !errors.As(err, &e) || e.Name != RandomCapability {
+		t.Fatalf("expect random capability denied, but found %v", err)
+	}
+}
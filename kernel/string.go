@@ -0,0 +1,396 @@
+package kernel
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+// string module, lengths and indexes count runes, not bytes
+
+const StringModuleName = "string"
+
+func init() {
+	RegisterBuiltinModule(newStringModule())
+}
+
+func toStrings(vals []Exp) ([]string, error) {
+	strs := make([]string, len(vals))
+	for i, val := range vals {
+		s, err := engine.ToString(val)
+		if err != nil {
+			return nil, fmt.Errorf("expect string, but found %s", val.String())
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+// string function, all arguments are strings
+func stringFunc(arity int, f func(strs []string) (Exp, error)) Exp {
+	return NewPrimitive(arity, func(vals []Exp) (Exp, error) {
+		strs, err := toStrings(vals)
+		if err != nil {
+			return nil, err
+		}
+		return f(strs)
+	})
+}
+
+func stringPredicate(f func(s, sub string) bool) Exp {
+	return stringFunc(2, func(strs []string) (Exp, error) {
+		return engine.NewBoolean(f(strs[0], strs[1])), nil
+	})
+}
+
+func stringMap(f func(s string) string) Exp {
+	return stringFunc(1, func(strs []string) (Exp, error) {
+		return engine.NewString(f(strs[0])), nil
+	})
+}
+
+// [string, width, pad], pad is repeated until string has width runes
+func padFunc(left bool) Exp {
+	return NewCallPrimitive(3, func(call CallContext, vals []Exp) (Exp, error) {
+		strs, err := toStrings([]Exp{vals[0], vals[2]})
+		if err != nil {
+			return nil, err
+		}
+		width, err := toIndex(vals[1])
+		if err != nil {
+			return nil, err
+		}
+		s, pad := strs[0], []rune(strs[1])
+		if len(pad) == 0 {
+			return nil, fmt.Errorf("empty pad string")
+		}
+
+		n := width - utf8.RuneCountInString(s)
+		if n <= 0 {
+			return engine.NewString(s), nil
+		}
+		if err := checkSeqLength(uint64(n)); err != nil {
+			return nil, err
+		}
+		if err := call.Reserve(engine.StringValue, int64(width)); err != nil {
+			return nil, err
+		}
+		padding := make([]rune, n)
+		for i := range padding {
+			padding[i] = pad[i%len(pad)]
+		}
+		if left {
+			return engine.NewString(string(padding) + s), nil
+		}
+		return engine.NewString(s + string(padding)), nil
+	})
+}
+
+// strings are shown as they are, others as json
+func displayString(v Exp) string {
+	if s, err := engine.ToString(v); err == nil {
+		return s
+	}
+	return v.String()
+}
+
+// go value for printf, integers keep their precision
+func formatArg(v Exp) interface{} {
+	switch v.Kind() {
+	case engine.StringValue:
+		s, _ := engine.ToString(v)
+		return s
+	case engine.BooleanValue:
+		b, _ := engine.ToBoolean(v)
+		return b
+	case engine.NumberValue:
+		if i, err := engine.ToInteger(v); err == nil {
+			return i.BigInt()
+		}
+		f, _ := engine.ToNumber(v)
+		return f
+	default:
+		return v.String()
+	}
+}
+
+// interpolate splits template into pieces, {name} is replaced by the value of m, {{ and }} are escaped braces.
+// pieces of a name used more than once share their string, so the length is known before they are joined.
+func interpolate(template string, m map[string]Exp) ([]string, error) {
+	var pieces []string
+	displays := make(map[string]string)
+	start := 0
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		switch {
+		case c == '{' && strings.HasPrefix(template[i:], "{{"), c == '}' && strings.HasPrefix(template[i:], "}}"):
+			pieces = append(pieces, template[start:i+1])
+			i++
+			start = i + 1
+		case c == '{':
+			end := strings.IndexByte(template[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed { in format string: %q", template)
+			}
+			name := template[i+1 : i+end]
+			display, ok := displays[name]
+			if !ok {
+				val, ok := m[name]
+				if !ok {
+					return nil, fmt.Errorf("missing value of {%s} in format string", name)
+				}
+				display = displayString(val)
+				displays[name] = display
+			}
+			pieces = append(pieces, template[start:i], display)
+			i += end
+			start = i + 1
+		}
+	}
+	return append(pieces, template[start:]), nil
+}
+
+// fmt refuses widths and precisions beyond this
+const maxFormatWidth = 1000000
+
+// formatLength estimates the length of a printf style format before it is built,
+// it is the template, the arguments printed plainly, and the widths and precisions of verbs.
+// a width or precision given by * is counted as the largest fmt accepts.
+func formatLength(template string, args []Exp) uint64 {
+	n := uint64(len(template))
+	for _, arg := range args {
+		n += uint64(len(displayString(arg)))
+	}
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' {
+			continue
+		}
+		// flags, argument indexes, widths and precisions up to the verb
+		for i++; i < len(template) && strings.IndexByte("+-# 0123456789.*[]", template[i]) >= 0; i++ {
+			switch c := template[i]; {
+			case c == '*':
+				n += maxFormatWidth
+			case c >= '0' && c <= '9':
+				j := i
+				for j < len(template) && template[j] >= '0' && template[j] <= '9' {
+					j++
+				}
+				w, err := strconv.Atoi(template[i:j])
+				if err != nil || w > maxFormatWidth {
+					w = maxFormatWidth
+				}
+				n += uint64(w)
+				i = j - 1
+			}
+		}
+	}
+	return n
+}
+
+// runes of the pieces, they are checked before they are joined
+func checkPieces(call CallContext, pieces []string) error {
+	var n uint64
+	for _, piece := range pieces {
+		n += uint64(len(piece))
+		if n > maxSeqLength {
+			return checkSeqLength(n)
+		}
+	}
+	var runes int64
+	for _, piece := range pieces {
+		runes += int64(utf8.RuneCountInString(piece))
+	}
+	return call.Reserve(engine.StringValue, runes)
+}
+
+func newStringModule() *Module {
+	values := map[string]Exp{
+		"length": stringFunc(1, func(strs []string) (Exp, error) {
+			return engine.NewInteger(int64(utf8.RuneCountInString(strs[0]))), nil
+		}),
+		// [string, start, end), end is exclusive
+		"substring": NewPrimitive(3, func(vals []Exp) (Exp, error) {
+			s, err := engine.ToString(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			start, err := toIndex(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			end, err := toIndex(vals[2])
+			if err != nil {
+				return nil, err
+			}
+			runes := []rune(s)
+			if start < 0 || end > len(runes) || start > end {
+				return nil, fmt.Errorf("substring out of range: [%d, %d), length is %d", start, end, len(runes))
+			}
+			return engine.NewString(string(runes[start:end])), nil
+		}),
+		"split": stringFunc(2, func(strs []string) (Exp, error) {
+			parts := strings.Split(strs[0], strs[1])
+			l := make([]Exp, len(parts))
+			for i, part := range parts {
+				l[i] = engine.NewString(part)
+			}
+			return engine.NewList(l), nil
+		}),
+		// [list, separator]
+		"join": NewPrimitive(2, func(vals []Exp) (Exp, error) {
+			l, err := engine.ToList(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			strs, err := toStrings(l)
+			if err != nil {
+				return nil, err
+			}
+			sep, err := engine.ToString(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			return engine.NewString(strings.Join(strs, sep)), nil
+		}),
+		"trim":  stringMap(strings.TrimSpace),
+		"upper": stringMap(strings.ToUpper),
+		"lower": stringMap(strings.ToLower),
+		// [string, old, new], all occurrences are replaced
+		"replace": NewCallPrimitive(3, func(call CallContext, vals []Exp) (Exp, error) {
+			strs, err := toStrings(vals)
+			if err != nil {
+				return nil, err
+			}
+			s, from, to := strs[0], strs[1], strs[2]
+			// an empty string is found before each rune and at the end
+			count := uint64(strings.Count(s, from))
+			if err := checkSeqLength(uint64(len(s)) - count*uint64(len(from)) + count*uint64(len(to))); err != nil {
+				return nil, err
+			}
+			runes := int64(utf8.RuneCountInString(s)) + int64(count)*int64(utf8.RuneCountInString(to)-utf8.RuneCountInString(from))
+			if err := call.Reserve(engine.StringValue, runes); err != nil {
+				return nil, err
+			}
+			return engine.NewString(strings.ReplaceAll(s, from, to)), nil
+		}),
+		"starts-with?": stringPredicate(strings.HasPrefix),
+		"ends-with?":   stringPredicate(strings.HasSuffix),
+		"contains?":    stringPredicate(strings.Contains),
+		// rune index of the first occurrence, -1 if not found
+		"index-of": stringFunc(2, func(strs []string) (Exp, error) {
+			i := strings.Index(strs[0], strs[1])
+			if i < 0 {
+				return engine.NewInteger(-1), nil
+			}
+			return engine.NewInteger(int64(utf8.RuneCountInString(strs[0][:i]))), nil
+		}),
+		"repeat": NewCallPrimitive(2, func(call CallContext, vals []Exp) (Exp, error) {
+			s, err := engine.ToString(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			n, err := toIndex(vals[1])
+			if err != nil {
+				return nil, err
+			}
+			if n < 0 {
+				return nil, fmt.Errorf("negative repeat count: %d", n)
+			}
+			// len(s)*n may overflow
+			if len(s) != 0 && uint64(n) > maxSeqLength/uint64(len(s)) {
+				return nil, fmt.Errorf("length out of range: %d repeats of %d bytes, at most %d", n, len(s), maxSeqLength)
+			}
+			if err := call.Reserve(engine.StringValue, int64(n*utf8.RuneCountInString(s))); err != nil {
+				return nil, err
+			}
+			return engine.NewString(strings.Repeat(s, n)), nil
+		}),
+		"pad-left":  padFunc(true),
+		"pad-right": padFunc(false),
+
+		"string->number": stringFunc(1, func(strs []string) (Exp, error) {
+			n, err := engine.ParseNumber(strings.TrimSpace(strs[0]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid number: %q", strs[0])
+			}
+			return n, nil
+		}),
+		"number->string": NewPrimitive(1, func(vals []Exp) (Exp, error) {
+			if _, err := engine.ToNumeric(vals[0]); err != nil {
+				return nil, err
+			}
+			return engine.NewString(vals[0].String()), nil
+		}),
+		// strings are unchanged, others are printed as json
+		"to-string": NewPrimitive(1, func(vals []Exp) (Exp, error) {
+			return engine.NewString(displayString(vals[0])), nil
+		}),
+		// [template, args], printf style if args is a list, {name} style if args is a map
+		"format": NewCallPrimitive(2, func(call CallContext, vals []Exp) (Exp, error) {
+			template, err := engine.ToString(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			switch vals[1].Kind() {
+			case engine.ListValue:
+				l, _ := engine.ToList(vals[1])
+				n := formatLength(template, l)
+				if err := checkSeqLength(n); err != nil {
+					return nil, err
+				}
+				if err := call.Reserve(engine.StringValue, int64(n)); err != nil {
+					return nil, err
+				}
+				args := make([]interface{}, len(l))
+				for i, val := range l {
+					args[i] = formatArg(val)
+				}
+				return engine.NewString(fmt.Sprintf(template, args...)), nil
+			case engine.MapValue:
+				m, _ := engine.ToMap(vals[1])
+				pieces, err := interpolate(template, m)
+				if err != nil {
+					return nil, err
+				}
+				if err := checkPieces(call, pieces); err != nil {
+					return nil, err
+				}
+				return engine.NewString(strings.Join(pieces, "")), nil
+			default:
+				return nil, fmt.Errorf("format arguments should be a list or a map, but found %s", vals[1].String())
+			}
+		}),
+	}
+
+	var (
+		stringFunc1  = FuncType{Params: []Type{stringType}, Result: stringType}
+		stringTest   = FuncType{Params: []Type{stringType, stringType}, Result: booleanType}
+		stringPadder = FuncType{Params: []Type{stringType, numberType, stringType}, Result: stringType}
+	)
+	types := map[string]Type{
+		"length":         FuncType{Params: []Type{stringType}, Result: numberType},
+		"substring":      FuncType{Params: []Type{stringType, numberType, numberType}, Result: stringType},
+		"split":          FuncType{Params: []Type{stringType, stringType}, Result: ListType{Elem: stringType}},
+		"join":           FuncType{Params: []Type{ListType{Elem: stringType}, stringType}, Result: stringType},
+		"trim":           stringFunc1,
+		"upper":          stringFunc1,
+		"lower":          stringFunc1,
+		"replace":        FuncType{Params: []Type{stringType, stringType, stringType}, Result: stringType},
+		"starts-with?":   stringTest,
+		"ends-with?":     stringTest,
+		"contains?":      stringTest,
+		"index-of":       FuncType{Params: []Type{stringType, stringType}, Result: numberType},
+		"repeat":         FuncType{Params: []Type{stringType, numberType}, Result: stringType},
+		"pad-left":       stringPadder,
+		"pad-right":      stringPadder,
+		"string->number": FuncType{Params: []Type{stringType}, Result: numberType},
+		"number->string": FuncType{Params: []Type{numberType}, Result: stringType},
+		"to-string":      FuncType{Params: []Type{anyType}, Result: stringType},
+		"format":         FuncType{Params: []Type{stringType, anyType}, Result: stringType},
+	}
+
+	return NewBuiltinModule(StringModuleName, values, types)
+}
@@ -0,0 +1,89 @@
+package kernel
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+// time, random and env modules, their primitives require capabilities of the same names
+
+const (
+	TimeModuleName   = "time"
+	RandomModuleName = "random"
+	EnvModuleName    = "env"
+)
+
+func init() {
+	RegisterBuiltinModule(newTimeModule())
+	RegisterBuiltinModule(newRandomModule())
+	RegisterBuiltinModule(newEnvModule())
+}
+
+func newTimeModule() *Module {
+	values := map[string]Exp{
+		// milliseconds since unix epoch
+		"now": WithCapability(TimeCapability, NewPrimitive(0, func(vals []Exp) (Exp, error) {
+			return engine.NewInteger(time.Now().UnixNano() / int64(time.Millisecond)), nil
+		})),
+	}
+
+	types := map[string]Type{
+		"now": FuncType{Result: numberType},
+	}
+
+	return NewBuiltinModule(TimeModuleName, values, types)
+}
+
+func newRandomModule() *Module {
+	values := map[string]Exp{
+		// float in [0, 1)
+		"random": WithCapability(RandomCapability, NewPrimitive(0, func(vals []Exp) (Exp, error) {
+			return engine.NewFloat(rand.Float64()), nil
+		})),
+		// integer in [0, n)
+		"random-int": WithCapability(RandomCapability, NewPrimitive(1, func(vals []Exp) (Exp, error) {
+			n, err := toIndex(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			if n <= 0 {
+				return nil, fmt.Errorf("random-int: expect positive bound, but found %d", n)
+			}
+			return engine.NewInteger(int64(rand.Intn(n))), nil
+		})),
+	}
+
+	types := map[string]Type{
+		"random":     FuncType{Result: numberType},
+		"random-int": FuncType{Params: []Type{numberType}, Result: numberType},
+	}
+
+	return NewBuiltinModule(RandomModuleName, values, types)
+}
+
+func newEnvModule() *Module {
+	values := map[string]Exp{
+		// value of environment variable, null if not set
+		"getenv": WithCapability(EnvCapability, NewPrimitive(1, func(vals []Exp) (Exp, error) {
+			name, err := engine.ToString(vals[0])
+			if err != nil {
+				return nil, err
+			}
+			val, ok := os.LookupEnv(name)
+			if !ok {
+				return engine.NewNull(), nil
+			}
+			return engine.NewString(val), nil
+		})),
+	}
+
+	types := map[string]Type{
+		"getenv": FuncType{Params: []Type{stringType}, Result: anyType},
+	}
+
+	return NewBuiltinModule(EnvModuleName, values, types)
+}
@@ -0,0 +1,815 @@
+package kernel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+// Type ::= "any" | "null" | "boolean" | "number" | "string"
+// | {"list": Type}
+// | {"map": Type}
+// | {"func": [[Type ...], Type]}
+// | {"record": {"name": Type, ...}}
+
+type Type interface {
+	String() string
+}
+
+type AnyType struct{}
+
+func (t AnyType) String() string {
+	return `"any"`
+}
+
+// null, boolean, number and string
+type KindType struct {
+	Kind engine.Kind
+}
+
+var kindTypeNames = map[engine.Kind]string{
+	engine.NullValue:    "null",
+	engine.BooleanValue: "boolean",
+	engine.NumberValue:  "number",
+	engine.StringValue:  "string",
+}
+
+func (t KindType) String() string {
+	return fmt.Sprintf("%q", kindTypeNames[t.Kind])
+}
+
+type ListType struct {
+	Elem Type
+}
+
+func (t ListType) String() string {
+	return fmt.Sprintf(`{"list": %s}`, t.Elem.String())
+}
+
+type MapType struct {
+	Elem Type
+}
+
+func (t MapType) String() string {
+	return fmt.Sprintf(`{"map": %s}`, t.Elem.String())
+}
+
+type FuncType struct {
+	Params []Type
+	// type of variadic args after params, nil if not variadic
+	Rest   Type
+	Result Type
+}
+
+func (t FuncType) String() string {
+	strs := make([]string, len(t.Params), len(t.Params)+1)
+	for i, p := range t.Params {
+		strs[i] = p.String()
+	}
+	if t.Rest != nil {
+		strs = append(strs, fmt.Sprintf(`{"rest": %s}`, t.Rest.String()))
+	}
+	return fmt.Sprintf(`{"func": [[%s], %s]}`, strings.Join(strs, ", "), t.Result.String())
+}
+
+func (t FuncType) Arity() Arity {
+	if t.Rest != nil {
+		return Arity{Min: len(t.Params), Max: Variadic}
+	}
+	return ExactArity(len(t.Params))
+}
+
+// type of i-th arg
+func (t FuncType) Param(i int) Type {
+	if i < len(t.Params) {
+		return t.Params[i]
+	}
+	return t.Rest
+}
+
+type RecordType struct {
+	Fields map[string]Type
+}
+
+func (t RecordType) String() string {
+	names := make([]string, 0, len(t.Fields))
+	for name := range t.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	strs := make([]string, len(names))
+	for i, name := range names {
+		strs[i] = fmt.Sprintf("%q: %s", name, t.Fields[name].String())
+	}
+	return fmt.Sprintf(`{"record": {%s}}`, strings.Join(strs, ", "))
+}
+
+var (
+	anyType     = AnyType{}
+	nullType    = KindType{Kind: engine.NullValue}
+	booleanType = KindType{Kind: engine.BooleanValue}
+	numberType  = KindType{Kind: engine.NumberValue}
+	stringType  = KindType{Kind: engine.StringValue}
+)
+
+func IsAnyType(t Type) bool {
+	_, ok := t.(AnyType)
+	return ok
+}
+
+// ParseType converts type annotation data into Type
+func ParseType(exp Exp) (Type, error) {
+	switch exp.Kind() {
+	case engine.StringValue:
+		name, _ := engine.ToString(exp)
+		switch name {
+		case "any":
+			return anyType, nil
+		case "null":
+			return nullType, nil
+		case "boolean":
+			return booleanType, nil
+		case "number":
+			return numberType, nil
+		case "string":
+			return stringType, nil
+		}
+	case engine.MapValue:
+		m, _ := engine.ToMap(exp)
+		if len(m) != 1 {
+			break
+		}
+		for name, sub := range m {
+			switch name {
+			case "list":
+				elem, err := ParseType(sub)
+				if err != nil {
+					return nil, err
+				}
+				return ListType{Elem: elem}, nil
+			case "map":
+				elem, err := ParseType(sub)
+				if err != nil {
+					return nil, err
+				}
+				return MapType{Elem: elem}, nil
+			case "func":
+				l, err := engine.ToList(sub)
+				if err != nil || len(l) != 2 {
+					break
+				}
+				paramExps, err := engine.ToList(l[0])
+				if err != nil {
+					break
+				}
+				params := make([]Type, 0, len(paramExps))
+				var rest Type
+				for i, paramExp := range paramExps {
+					// {"rest": type} is the last param
+					if m, err := engine.ToMap(paramExp); err == nil && len(m) == 1 && m["rest"] != nil && i == len(paramExps)-1 {
+						rest, err = ParseType(m["rest"])
+						if err != nil {
+							return nil, err
+						}
+						break
+					}
+					param, err := ParseType(paramExp)
+					if err != nil {
+						return nil, err
+					}
+					params = append(params, param)
+				}
+				result, err := ParseType(l[1])
+				if err != nil {
+					return nil, err
+				}
+				return FuncType{Params: params, Rest: rest, Result: result}, nil
+			case "record":
+				fieldExps, err := engine.ToMap(sub)
+				if err != nil {
+					break
+				}
+				fields := make(map[string]Type, len(fieldExps))
+				for field, fieldExp := range fieldExps {
+					fields[field], err = ParseType(fieldExp)
+					if err != nil {
+						return nil, err
+					}
+				}
+				return RecordType{Fields: fields}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid type: %s", exp.String())
+}
+
+func EqualType(t1, t2 Type) bool {
+	return Assignable(t1, t2) && Assignable(t2, t1)
+}
+
+// Assignable reports whether a value of type from can be used as type to,
+// any is consistent with every type.
+func Assignable(from, to Type) bool {
+	if IsAnyType(from) || IsAnyType(to) {
+		return true
+	}
+
+	switch t := to.(type) {
+	case KindType:
+		f, ok := from.(KindType)
+		return ok && f.Kind == t.Kind
+	case ListType:
+		f, ok := from.(ListType)
+		return ok && Assignable(f.Elem, t.Elem)
+	case MapType:
+		switch f := from.(type) {
+		case MapType:
+			return Assignable(f.Elem, t.Elem)
+		case RecordType:
+			for _, fieldType := range f.Fields {
+				if !Assignable(fieldType, t.Elem) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	case RecordType:
+		f, ok := from.(RecordType)
+		if !ok {
+			return false
+		}
+		for name, fieldType := range t.Fields {
+			ft, ok := f.Fields[name]
+			if !ok || !Assignable(ft, fieldType) {
+				return false
+			}
+		}
+		return true
+	case FuncType:
+		// from should accept every args of to
+		f, ok := from.(FuncType)
+		if !ok || len(f.Params) > len(t.Params) {
+			return false
+		}
+		if t.Rest != nil && f.Rest == nil {
+			return false
+		}
+		if t.Rest == nil && f.Rest == nil && len(f.Params) != len(t.Params) {
+			return false
+		}
+		for i, param := range t.Params {
+			if !Assignable(param, f.Param(i)) {
+				return false
+			}
+		}
+		if t.Rest != nil && !Assignable(t.Rest, f.Rest) {
+			return false
+		}
+		return Assignable(f.Result, t.Result)
+	}
+	return false
+}
+
+func joinType(t1, t2 Type) Type {
+	if EqualType(t1, t2) && !IsAnyType(t1) && !IsAnyType(t2) {
+		return t1
+	}
+	return anyType
+}
+
+// TypeOfValue infers the type of evaluated value
+func TypeOfValue(val Exp) Type {
+	switch val.Kind() {
+	case engine.NullValue, engine.BooleanValue, engine.NumberValue, engine.StringValue:
+		return KindType{Kind: val.Kind()}
+	case engine.ListValue:
+		l, _ := engine.ToList(val)
+		return ListType{Elem: joinTypes(l, TypeOfValue)}
+	case engine.MapValue:
+		m, _ := engine.ToMap(val)
+		fields := make(map[string]Type, len(m))
+		for name, sub := range m {
+			fields[name] = TypeOfValue(sub)
+		}
+		return RecordType{Fields: fields}
+	default:
+		return anyType
+	}
+}
+
+func joinTypes(l []Exp, typeOf func(Exp) Type) Type {
+	if len(l) == 0 {
+		return anyType
+	}
+	t := typeOf(l[0])
+	for _, sub := range l[1:] {
+		t = joinType(t, typeOf(sub))
+	}
+	return t
+}
+
+// prelude
+
+// numbers, at least min of them
+func numberOp(min int, result Type) Type {
+	params := make([]Type, min)
+	for i := range params {
+		params[i] = numberType
+	}
+	return FuncType{Params: params, Rest: numberType, Result: result}
+}
+
+var preludeTypes = map[string]Type{
+	"+":              numberOp(0, numberType),
+	"-":              numberOp(1, numberType),
+	"*":              numberOp(0, numberType),
+	"/":              numberOp(1, numberType),
+	"<":              numberOp(1, booleanType),
+	">":              numberOp(1, booleanType),
+	"<=":             numberOp(1, booleanType),
+	">=":             numberOp(1, booleanType),
+	"=":              numberOp(1, booleanType),
+	"equal":          FuncType{Params: []Type{anyType, anyType}, Result: booleanType},
+	"append-string":  FuncType{Rest: stringType, Result: stringType},
+	"decimal":        FuncType{Params: []Type{anyType}, Result: numberType},
+	"decimal-round":  FuncType{Params: []Type{numberType, numberType, stringType}, Result: numberType},
+	"decimal-format": FuncType{Params: []Type{numberType, numberType}, Result: stringType},
+}
+
+// type checking
+
+type TypeCheckError struct {
+	Exp     Exp
+	Message string
+}
+
+func (e *TypeCheckError) Error() string {
+	return fmt.Sprintf("%s, in %s", e.Message, e.Exp.String())
+}
+
+// all type errors found in a module
+type TypeCheckErrors struct {
+	Module string
+	Errors []*TypeCheckError
+}
+
+func (errs *TypeCheckErrors) Error() string {
+	strs := make([]string, len(errs.Errors))
+	for i, err := range errs.Errors {
+		strs[i] = fmt.Sprintf("%s: type error: %s", errs.Module, err.Error())
+	}
+	return strings.Join(strs, "\n")
+}
+
+type typeEnv struct {
+	types  map[string]Type
+	parent *typeEnv
+}
+
+func newTypeEnv(parent *typeEnv, types map[string]Type) *typeEnv {
+	if types == nil {
+		types = make(map[string]Type)
+	}
+	return &typeEnv{
+		types:  types,
+		parent: parent,
+	}
+}
+
+func (e *typeEnv) lookup(name string) Type {
+	for env := e; env != nil; env = env.parent {
+		if t, ok := env.types[name]; ok {
+			return t
+		}
+	}
+	return anyType
+}
+
+func (e *typeEnv) frameOf(name string) *typeEnv {
+	for env := e; env != nil; env = env.parent {
+		if _, ok := env.types[name]; ok {
+			return env
+		}
+	}
+	return nil
+}
+
+type typeChecker struct {
+	errs []*TypeCheckError
+	// names set anywhere in the body, their definitions are not narrowed by local inference
+	setNames map[string]struct{}
+}
+
+// collectSetNames records the names set in exp, whatever scope they are in
+func (c *typeChecker) collectSetNames(exp Exp) {
+	switch exp.Kind() {
+	case engine.ReducibleExp:
+		r, _ := engine.ToRedex(exp)
+		if r.Name == "set" {
+			if m, err := engine.ToMapExp(r.Exp); err == nil {
+				for name := range m {
+					c.setNames[name] = struct{}{}
+				}
+			}
+		}
+		c.collectSetNames(r.Exp)
+	case engine.ListExp:
+		l, _ := engine.ToListExp(exp)
+		for _, sub := range l {
+			c.collectSetNames(sub)
+		}
+	case engine.MapExp:
+		m, _ := engine.ToMapExp(exp)
+		for _, sub := range m {
+			c.collectSetNames(sub)
+		}
+	}
+}
+
+func (c *typeChecker) errorf(exp Exp, format string, args ...interface{}) {
+	c.errs = append(c.errs, &TypeCheckError{
+		Exp:     exp,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// IsTyped reports whether exps contain any type annotation
+func IsTyped(exps ...Exp) bool {
+	for _, exp := range exps {
+		if isTyped(exp) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTyped(exp Exp) bool {
+	switch exp.Kind() {
+	case engine.ReducibleExp:
+		r, _ := engine.ToRedex(exp)
+		switch r.Name {
+		case "the":
+			return true
+		case "func":
+			l, err := engine.ToListExp(r.Exp)
+			if err != nil || len(l) < 2 {
+				return false
+			}
+			if argExps, err := engine.ToListExp(l[0]); err == nil {
+				for _, argExp := range argExps {
+					if _, t, err := funcArg(argExp); err == nil && t != nil {
+						return true
+					}
+				}
+			}
+			if len(l) == 3 {
+				if clauses, err := engine.ToMapExp(l[2]); err == nil {
+					if _, ok := clauses[ReturnsClause]; ok {
+						return true
+					}
+				}
+			}
+			return isTyped(l[1])
+		}
+		return isTyped(r.Exp)
+	case engine.ListExp:
+		l, _ := engine.ToListExp(exp)
+		return IsTyped(l...)
+	case engine.MapExp:
+		m, _ := engine.ToMapExp(exp)
+		for _, sub := range m {
+			if isTyped(sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckTypes type checks module body, bound gives types of names visible in the module.
+// It reports all type errors found, not just the first one.
+func CheckTypes(moduleName string, body []Exp, bound map[string]Type) (map[string]Type, error) {
+	c := &typeChecker{setNames: make(map[string]struct{})}
+	env := newTypeEnv(newTypeEnv(nil, bound), nil)
+	for _, exp := range body {
+		c.collectSetNames(exp)
+		c.declareDefs(exp, env)
+	}
+	for _, exp := range body {
+		c.infer(exp, env)
+	}
+
+	if len(c.errs) != 0 {
+		return nil, &TypeCheckErrors{
+			Module: moduleName,
+			Errors: c.errs,
+		}
+	}
+	return env.types, nil
+}
+
+func preludeTypeEnv() map[string]Type {
+	types := make(map[string]Type, len(preludeTypes))
+	for name, t := range preludeTypes {
+		types[name] = t
+	}
+	return types
+}
+
+func (c *typeChecker) parseType(exp Exp, at Exp) Type {
+	t, err := ParseType(exp)
+	if err != nil {
+		c.errorf(at, "%s", err.Error())
+		return anyType
+	}
+	return t
+}
+
+func isAnnotation(exp Exp) bool {
+	r, err := engine.ToRedex(exp)
+	return err == nil && r.Name == "the"
+}
+
+// declared type of exp, known without checking it
+func (c *typeChecker) declaredType(exp Exp) Type {
+	r, err := engine.ToRedex(exp)
+	if err != nil {
+		if engine.IsValue(exp) {
+			return TypeOfValue(exp)
+		}
+		return anyType
+	}
+
+	switch r.Name {
+	case "the":
+		l, err := engine.ToListExp(r.Exp)
+		if err != nil || len(l) != 2 {
+			return anyType
+		}
+		t, err := ParseType(l[0])
+		if err != nil {
+			return anyType
+		}
+		return t
+	case "func":
+		params, result, ok := c.funcSignature(r, false)
+		if !ok {
+			return anyType
+		}
+		return FuncType{Params: params, Result: result}
+	default:
+		return anyType
+	}
+}
+
+func (c *typeChecker) funcSignature(r engine.Redex, report bool) ([]Type, Type, bool) {
+	l, err := engine.ToListExp(r.Exp)
+	if err != nil || len(l) < 2 {
+		return nil, nil, false
+	}
+	argExps, err := engine.ToListExp(l[0])
+	if err != nil {
+		return nil, nil, false
+	}
+
+	params := make([]Type, len(argExps))
+	for i, argExp := range argExps {
+		params[i] = anyType
+		if _, t, err := funcArg(argExp); err == nil && t != nil {
+			if report {
+				params[i] = c.parseType(t, r)
+			} else if pt, err := ParseType(t); err == nil {
+				params[i] = pt
+			}
+		}
+	}
+
+	var result Type = anyType
+	if len(l) == 3 {
+		if clauses, err := engine.ToMapExp(l[2]); err == nil {
+			if t, ok := clauses[ReturnsClause]; ok {
+				if report {
+					result = c.parseType(t, r)
+				} else if rt, err := ParseType(t); err == nil {
+					result = rt
+				}
+			}
+		}
+	}
+	return params, result, true
+}
+
+// declareDefs binds defined names in env before checking, so recursive functions can be checked
+func (c *typeChecker) declareDefs(exp Exp, env *typeEnv) {
+	switch exp.Kind() {
+	case engine.ReducibleExp:
+		r, _ := engine.ToRedex(exp)
+		switch r.Name {
+		case "func", "block", "module":
+			return
+		case "def":
+			m, err := engine.ToMapExp(r.Exp)
+			if err != nil {
+				return
+			}
+			for name, sub := range m {
+				env.types[name] = c.declaredType(sub)
+				// only annotations bind names that are set
+				if _, isSet := c.setNames[name]; isSet && !isAnnotation(sub) {
+					env.types[name] = anyType
+				}
+			}
+			return
+		}
+		c.declareDefs(r.Exp, env)
+	case engine.ListExp:
+		l, _ := engine.ToListExp(exp)
+		for _, sub := range l {
+			c.declareDefs(sub, env)
+		}
+	}
+}
+
+func (c *typeChecker) infer(exp Exp, env *typeEnv) Type {
+	switch exp.Kind() {
+	case engine.ReducibleExp:
+		r, _ := engine.ToRedex(exp)
+		return c.inferRedex(r, env)
+	case engine.ListExp:
+		l, _ := engine.ToListExp(exp)
+		return ListType{Elem: joinTypes(l, func(sub Exp) Type {
+			return c.infer(sub, env)
+		})}
+	case engine.MapExp:
+		m, _ := engine.ToMapExp(exp)
+		fields := make(map[string]Type, len(m))
+		for name, sub := range m {
+			fields[name] = c.infer(sub, env)
+		}
+		return RecordType{Fields: fields}
+	case engine.SuspendExp, engine.SuspendValue, engine.DelayedExp:
+		return anyType
+	default:
+		return TypeOfValue(exp)
+	}
+}
+
+func (c *typeChecker) inferRedex(r engine.Redex, env *typeEnv) Type {
+	switch r.Name {
+	case "var":
+		name, err := engine.ToString(r.Exp)
+		if err != nil {
+			return anyType
+		}
+		return env.lookup(name)
+	case "the":
+		l, err := engine.ToListExp(r.Exp)
+		if err != nil || len(l) != 2 {
+			return anyType
+		}
+		t := c.parseType(l[0], r)
+		if actual := c.infer(l[1], env); !Assignable(actual, t) {
+			c.errorf(r, "expect %s, but found %s", t.String(), actual.String())
+		}
+		return t
+	case "func":
+		return c.inferFunc(r, env)
+	case "apply":
+		return c.inferApply(r, env)
+	case "if":
+		l, err := engine.ToListExp(r.Exp)
+		if err != nil || len(l) != 3 {
+			return anyType
+		}
+		if t := c.infer(l[0], env); !Assignable(t, booleanType) {
+			c.errorf(r, "if test should be boolean, but found %s", t.String())
+		}
+		return joinType(c.infer(l[1], env), c.infer(l[2], env))
+	case "begin":
+		l, err := engine.ToListExp(r.Exp)
+		if err != nil || len(l) == 0 {
+			return anyType
+		}
+		var t Type = anyType
+		for _, sub := range l {
+			t = c.infer(sub, env)
+		}
+		return t
+	case "block":
+		newEnv := newTypeEnv(env, nil)
+		c.declareDefs(r.Exp, newEnv)
+		return c.infer(r.Exp, newEnv)
+	case "def":
+		m, err := engine.ToMapExp(r.Exp)
+		if err != nil {
+			return nullType
+		}
+		for name, sub := range m {
+			declared := env.lookup(name)
+			actual := c.infer(sub, env)
+			if !Assignable(actual, declared) {
+				c.errorf(r, "cannot define %s as %s, declared %s", name, actual.String(), declared.String())
+			} else if _, isSet := c.setNames[name]; IsAnyType(declared) && !isSet {
+				// local inference, unless a later set may change the type
+				if frame := env.frameOf(name); frame != nil {
+					frame.types[name] = actual
+				}
+			}
+		}
+		return nullType
+	case "set":
+		m, err := engine.ToMapExp(r.Exp)
+		if err != nil {
+			return nullType
+		}
+		for name, sub := range m {
+			declared := env.lookup(name)
+			if actual := c.infer(sub, env); !Assignable(actual, declared) {
+				c.errorf(r, "cannot set %s to %s, declared %s", name, actual.String(), declared.String())
+			}
+		}
+		return nullType
+	case "import", "export", "module":
+		return nullType
+	default:
+		c.infer(r.Exp, env)
+		return anyType
+	}
+}
+
+func (c *typeChecker) inferFunc(r engine.Redex, env *typeEnv) Type {
+	params, result, ok := c.funcSignature(r, true)
+	if !ok {
+		return anyType
+	}
+	l, _ := engine.ToListExp(r.Exp)
+	argExps, _ := engine.ToListExp(l[0])
+
+	kvs := make(map[string]Type, len(argExps))
+	for i, argExp := range argExps {
+		if name, _, err := funcArg(argExp); err == nil {
+			kvs[name] = params[i]
+		}
+	}
+	newEnv := newTypeEnv(env, kvs)
+
+	if len(l) == 3 {
+		clauses, _ := engine.ToMapExp(l[2])
+		if pre, ok := clauses[PreContract]; ok {
+			c.infer(pre, newEnv)
+		}
+		if post, ok := clauses[PostContract]; ok {
+			c.infer(post, newTypeEnv(newEnv, map[string]Type{
+				ContractResultName: result,
+			}))
+		}
+	}
+
+	bodyEnv := newTypeEnv(newEnv, nil)
+	c.declareDefs(l[1], bodyEnv)
+	actual := c.infer(l[1], bodyEnv)
+	if !Assignable(actual, result) {
+		c.errorf(r, "function should return %s, but found %s", result.String(), actual.String())
+	}
+	if IsAnyType(result) {
+		result = actual
+	}
+
+	return FuncType{Params: params, Result: result}
+}
+
+func (c *typeChecker) inferApply(r engine.Redex, env *typeEnv) Type {
+	l, err := engine.ToListExp(r.Exp)
+	if err != nil || len(l) == 0 {
+		return anyType
+	}
+
+	fnType := c.infer(l[0], env)
+	argTypes := make([]Type, len(l)-1)
+	for i, argExp := range l[1:] {
+		argTypes[i] = c.infer(argExp, env)
+	}
+
+	switch t := fnType.(type) {
+	case AnyType:
+		return anyType
+	case FuncType:
+		if !t.Arity().Accepts(len(argTypes)) {
+			c.errorf(r, "expect %s, but found %d", t.Arity().String(), len(argTypes))
+			return t.Result
+		}
+		for i, argType := range argTypes {
+			if !Assignable(argType, t.Param(i)) {
+				c.errorf(r, "arg %d should be %s, but found %s", i+1, t.Param(i).String(), argType.String())
+			}
+		}
+		return t.Result
+	default:
+		c.errorf(r, "cannot apply %s", fnType.String())
+		return anyType
+	}
+}
@@ -0,0 +1,143 @@
+package kernel
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/crcc/jsonp/engine"
+)
+
+func TestCheckTypes_Fact(t *testing.T) {
+	e := mustParse(`{"begin": [
+		{"def": {
+		  "fact": {"func": [[["n", "number"]], {"returns": "number"},
+					 {"if": [["<=", "n", 0],
+							 1,
+							 ["*", "n", ["fact", ["-", "n", 1]]]]}
+				  ]}
+		}},
+		{"def": {"x": {"the": ["number", ["fact", 5]]}}},
+		"x"
+	]}`)
+
+	if _, err := CheckTypes("top level", []Exp{e}, preludeTypeEnv()); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	val, err := interp(e)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !engine.NewNumber(120).Equal(val) {
+		t.Fatalf("expect 120")
+	}
+}
+
+func TestCheckTypes_Errors(t *testing.T) {
+	e := mustParse(`{"begin": [
+		{"def": {
+		  "f": {"func": [[["s", "string"]], {"returns": "number"}, ["append-string", "s", "s"]]},
+		  "g": {"func": [[["l", {"list": "number"}]], "l"]},
+		  "y": {"the": ["string", 1]}
+		}},
+		["f", 1],
+		["g", {"data": [1, "a"]}],
+		["f", {"data": "a"}, 2]
+	]}`)
+
+	_, err := CheckTypes("top level", []Exp{e}, preludeTypeEnv())
+	errs, ok := err.(*TypeCheckErrors)
+	if !ok {
+		t.Fatalf("expect type errors, but found %v", err)
+	}
+	if len(errs.Errors) != 4 {
+		t.Fatalf("expect 4 type errors, but found:\n%s", errs.Error())
+	}
+}
+
+func TestCheckTypes_Set(t *testing.T) {
+	e := mustParse(`{"begin": [
+		{"def": {"x": 1, "y": {"the": ["number", 1]}, "z": 1}},
+		{"def": {"reset": {"func": [[], {"set": {"x": {"data": "a"}}}]}}},
+		["reset"],
+		{"set": {"y": {"data": "a"}}},
+		["append-string", "z"]
+	]}`)
+
+	_, err := CheckTypes("top level", []Exp{e}, preludeTypeEnv())
+	errs, ok := err.(*TypeCheckErrors)
+	if !ok {
+		t.Fatalf("expect type errors, but found %v", err)
+	}
+	// x is set to another type, y is declared number, z is inferred number
+	if len(errs.Errors) != 2 {
+		t.Fatalf("expect 2 type errors, but found:\n%s", errs.Error())
+	}
+	for _, e := range errs.Errors {
+		if strings.Contains(e.Message, "set x") {
+			t.Fatalf("expect x settable, but found %s", e.Message)
+		}
+	}
+}
+
+func TestParseType(t *testing.T) {
+	exp, err := jsonStructParser.ParseData(map[string]interface{}{
+		"func": []interface{}{
+			[]interface{}{map[string]interface{}{"list": "number"}},
+			map[string]interface{}{"record": map[string]interface{}{"a": "string"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	typ, err := ParseType(exp)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expect := FuncType{
+		Params: []Type{ListType{Elem: numberType}},
+		Result: RecordType{Fields: map[string]Type{"a": stringType}},
+	}
+	if !EqualType(typ, expect) {
+		t.Fatalf("expect %s, but found %s", expect.String(), typ.String())
+	}
+}
+
+func TestCheckTypes_Variadic(t *testing.T) {
+	e := mustParse(`{"begin": [
+		{"def": {
+		  "f": {"func": [[["x", "number"]], {"returns": "number"}, ["+", "x", 1, 2]]},
+		  "apply3": {"func": [[["g", {"func": [["number", "number", "number"], "number"]}]], ["g", 1, 2, 3]]}
+		}},
+		["apply3", "+"],
+		["<", 1, 2, {"data": "a"}]
+	]}`)
+
+	_, err := CheckTypes("top level", []Exp{e}, preludeTypeEnv())
+	errs, ok := err.(*TypeCheckErrors)
+	if !ok {
+		t.Fatalf("expect type errors, but found %v", err)
+	}
+	if len(errs.Errors) != 1 {
+		t.Fatalf("expect 1 type error, but found:\n%s", errs.Error())
+	}
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(`{"func": [["string", {"rest": "number"}], "null"]}`), &v); err != nil {
+		t.Fatal(err.Error())
+	}
+	exp, err := jsonStructParser.ParseData(v)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	typ, err := ParseType(exp)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expect := FuncType{Params: []Type{stringType}, Rest: numberType, Result: nullType}
+	if !EqualType(typ, expect) || typ.String() != expect.String() {
+		t.Fatalf("expect %s, but found %s", expect.String(), typ.String())
+	}
+}
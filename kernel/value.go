@@ -3,6 +3,7 @@ package kernel
 import (
 	"errors"
 	"fmt"
+	"regexp"
 
 	"github.com/crcc/jsonp/engine"
 )
@@ -13,13 +14,31 @@ const (
 	UninitializedValue engine.Kind = engine.CustomValue + 1
 	PrimitiveFuncValue engine.Kind = engine.CustomValue + 2
 	AmbiguousValue     engine.Kind = engine.CustomValue + 3
+	CastedFuncValue    engine.Kind = engine.CustomValue + 4
+	RegexValue         engine.Kind = engine.CustomValue + 5
 )
 
+func init() {
+	engine.RegisterKindName(ClosureValue, "closure")
+	engine.RegisterKindName(UninitializedValue, "uninitialized value")
+	engine.RegisterKindName(PrimitiveFuncValue, "primitive function")
+	engine.RegisterKindName(AmbiguousValue, "ambiguous value")
+	engine.RegisterKindName(CastedFuncValue, "casted function")
+	engine.RegisterKindName(RegexValue, "regex")
+}
+
 // Closure
 type Closure struct {
+	// name given by def, empty if anonymous
+	Name string
 	Args []string
 	Body Exp
 	Env  Env
+	// optional contracts, nil if absent
+	Pre  Exp
+	Post Exp
+	// module where the closure is created, nil at top level
+	Module *Module
 }
 
 func (clo Closure) Kind() engine.Kind {
@@ -46,11 +65,15 @@ func NewClosure(args []string, body Exp, env Env) Closure {
 	}
 }
 
+func (clo Closure) HasContract() bool {
+	return clo.Pre != nil || clo.Post != nil
+}
+
 var ErrNotClosureValue = errors.New("Not Closure Value")
 
 func ToClosure(exp Exp) (Closure, error) {
 	if exp.Kind() != ClosureValue {
-		return Closure{}, ErrNotClosureValue
+		return Closure{}, engine.NewTypeError(ClosureValue, exp, ErrNotClosureValue)
 	}
 
 	return exp.(Closure), nil
@@ -81,10 +104,44 @@ func IsUninitializedValue(exp Exp) bool {
 	return exp.Kind() == UninitializedValue
 }
 
+// Arity, range of argument count
+type Arity struct {
+	Min int
+	// Variadic if there is no upper bound
+	Max int
+}
+
+const Variadic = -1
+
+func ExactArity(n int) Arity {
+	return Arity{Min: n, Max: n}
+}
+
+func (a Arity) Accepts(n int) bool {
+	return n >= a.Min && (a.Max == Variadic || n <= a.Max)
+}
+
+func (a Arity) String() string {
+	switch {
+	case a.Min == a.Max:
+		return fmt.Sprintf("%d args", a.Min)
+	case a.Max == Variadic:
+		return fmt.Sprintf("at least %d args", a.Min)
+	default:
+		return fmt.Sprintf("%d to %d args", a.Min, a.Max)
+	}
+}
+
 // Primitive Function
 type PrimitiveFunc struct {
-	Arity int
+	// name in error messages, set when exported by builtin module
+	Name  string
+	Arity Arity
 	Func  func(vals []Exp) (Exp, error)
+	// call primitive can apply closures and read context, it is called instead of Func if not nil
+	CallFunc func(call CallContext, vals []Exp) (Exp, error)
+	// capability required by primitive with side effects, empty if pure
+	Capability string
 }
 
 func (p PrimitiveFunc) Kind() engine.Kind {
@@ -101,21 +158,39 @@ func (p PrimitiveFunc) Equal(exp Exp) bool {
 }
 
 func (p PrimitiveFunc) String() string {
+	if p.Name != "" {
+		return fmt.Sprintf(`{"primitiveFunc": %q}`, p.Name)
+	}
 	return fmt.Sprintf(`{"primitiveFunc": %p}`, &p)
 }
 
 func NewPrimitive(arity int, f func(vals []Exp) (Exp, error)) Exp {
+	return NewVariadicPrimitive(ExactArity(arity), f)
+}
+
+func NewVariadicPrimitive(arity Arity, f func(vals []Exp) (Exp, error)) Exp {
 	return PrimitiveFunc{
 		Arity: arity,
 		Func:  f,
 	}
 }
 
+func NewCallPrimitive(arity int, f func(call CallContext, vals []Exp) (Exp, error)) Exp {
+	return NewVariadicCallPrimitive(ExactArity(arity), f)
+}
+
+func NewVariadicCallPrimitive(arity Arity, f func(call CallContext, vals []Exp) (Exp, error)) Exp {
+	return PrimitiveFunc{
+		Arity:    arity,
+		CallFunc: f,
+	}
+}
+
 var ErrNotPrimitiveFuncValue = errors.New("Not Primitive Function Value")
 
 func ToPrimitive(exp Exp) (PrimitiveFunc, error) {
 	if exp.Kind() != PrimitiveFuncValue {
-		return PrimitiveFunc{}, ErrNotPrimitiveFuncValue
+		return PrimitiveFunc{}, engine.NewTypeError(PrimitiveFuncValue, exp, ErrNotPrimitiveFuncValue)
 	}
 
 	return exp.(PrimitiveFunc), nil
@@ -145,3 +220,85 @@ func NewAmbiguousValue() AmbiguousVal {
 func IsAmbiguousValue(exp Exp) bool {
 	return exp.Kind() == AmbiguousValue
 }
+
+// Casted Function
+type CastedFunc struct {
+	Func Exp
+	Type FuncType
+	// party providing the function
+	Positive string
+	// party using the function
+	Negative string
+}
+
+func (c CastedFunc) Kind() engine.Kind {
+	return CastedFuncValue
+}
+
+func (c CastedFunc) Equal(exp Exp) bool {
+	if exp.Kind() != CastedFuncValue {
+		return false
+	}
+
+	c2 := exp.(CastedFunc)
+	return c.Func.Equal(c2.Func) && EqualType(c.Type, c2.Type)
+}
+
+func (c CastedFunc) String() string {
+	return fmt.Sprintf(`{"cast": [%s, %s]}`, c.Type.String(), c.Func.String())
+}
+
+func NewCastedFunc(fn Exp, t FuncType, positive, negative string) CastedFunc {
+	return CastedFunc{
+		Func:     fn,
+		Type:     t,
+		Positive: positive,
+		Negative: negative,
+	}
+}
+
+var ErrNotCastedFuncValue = errors.New("Not Casted Function Value")
+
+func ToCastedFunc(exp Exp) (CastedFunc, error) {
+	if exp.Kind() != CastedFuncValue {
+		return CastedFunc{}, engine.NewTypeError(CastedFuncValue, exp, ErrNotCastedFuncValue)
+	}
+
+	return exp.(CastedFunc), nil
+}
+
+// Regex
+type Regex struct {
+	Regexp *regexp.Regexp
+}
+
+func (re Regex) Kind() engine.Kind {
+	return RegexValue
+}
+
+func (re Regex) Equal(exp Exp) bool {
+	if exp.Kind() != RegexValue {
+		return false
+	}
+
+	re2 := exp.(Regex)
+	return re.Regexp.String() == re2.Regexp.String()
+}
+
+func (re Regex) String() string {
+	return fmt.Sprintf(`{"regex": %q}`, re.Regexp.String())
+}
+
+func NewRegex(re *regexp.Regexp) Regex {
+	return Regex{Regexp: re}
+}
+
+var ErrNotRegexValue = errors.New("Not Regex Value")
+
+func ToRegex(exp Exp) (Regex, error) {
+	if exp.Kind() != RegexValue {
+		return Regex{}, engine.NewTypeError(RegexValue, exp, ErrNotRegexValue)
+	}
+
+	return exp.(Regex), nil
+}
@@ -21,6 +21,10 @@ type Repl interface {
 	Parse(r io.Reader) (Exp, error)
 	EvalInteractive(exp Exp) (Exp, error)
 	AddPaths(paths []string)
+	// streams of program io, like print and read-line
+	SetStdout(w io.Writer)
+	SetStderr(w io.Writer)
+	SetStdin(r io.Reader)
 }
 
 var ErrStopRepl = errors.New("Stop Repl")
@@ -67,7 +71,14 @@ func isBatch() bool {
 	return !interactive && batchModule != ""
 }
 
+// Do runs repl e on os streams
 func Do(e Repl) error {
+	return Run(e, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// Run runs repl e, reading expressions from in, and writing results to out,
+// programs evaluated read from in too, and write to out and errOut
+func Run(e Repl, in io.Reader, out, errOut io.Writer) error {
 	// process arguments
 	if len(flag.Args()) > 1 {
 		return fmt.Errorf("expect at most one filename")
@@ -81,6 +92,9 @@ func Do(e Repl) error {
 		return err
 	}
 	e.AddPaths(paths)
+	e.SetStdin(in)
+	e.SetStdout(out)
+	e.SetStderr(errOut)
 
 	// eval in batch mode
 	if isBatch() {
@@ -92,10 +106,13 @@ func Do(e Repl) error {
 		exp, val Exp
 	)
 	for {
-		fmt.Print("> ")
-		exp, err = e.Parse(os.Stdin)
+		fmt.Fprint(out, "> ")
+		exp, err = e.Parse(in)
 		if err != nil {
-			fmt.Printf("Error: %s\n", err.Error())
+			if err == io.EOF {
+				return nil
+			}
+			fmt.Fprintf(out, "Error: %s\n", err.Error())
 			continue
 		}
 
@@ -104,11 +121,10 @@ func Do(e Repl) error {
 			if err == ErrStopRepl {
 				return nil
 			}
-			fmt.Printf("Error: %s\n", err.Error())
+			// with the jsonp stack trace, if any
+			fmt.Fprintf(out, "Error: %+v\n", err)
 			continue
 		}
-		fmt.Printf("Value: %s\n", val.String())
+		fmt.Fprintf(out, "Value: %s\n", val.String())
 	}
-
-	return nil
 }
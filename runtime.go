@@ -0,0 +1,218 @@
+package jsonp
+
+import (
+	gocontext "context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/crcc/jsonp/engine"
+	"github.com/crcc/jsonp/kernel"
+)
+
+type Exp = engine.Exp
+
+// Runtime embeds jsonp in go programs.
+// modules are loaded once, and top level definitions persist between evaluations.
+// a Runtime is not safe for concurrent use.
+type Runtime struct {
+	parser      engine.Parser
+	interpreter engine.Interpreter
+	loader      *kernel.FileModuleLoader
+	modules     map[string]*kernel.Module
+	globals     map[string]Exp
+	stdout      io.Writer
+	stderr      io.Writer
+	stdin       io.Reader
+	contracts   bool
+	// nil if unrestricted
+	sandbox *kernel.Sandbox
+	// evaluation is canceled when it is done, nil if never
+	goCtx gocontext.Context
+	// limits of each evaluation, nil if unlimited
+	limits *engine.Limits
+	// meter of the last evaluation
+	meter *engine.Meter
+	// rounding of decimal division, nil if default
+	decimal *engine.DecimalContext
+}
+
+func NewRuntime(findPaths []string) *Runtime {
+	return &Runtime{
+		parser:      engine.ParserFunc(kernel.ParseJson),
+		interpreter: kernel.NewKernelInterpreter(),
+		loader:      kernel.NewFileModuleLoader(findPaths, engine.ParserFunc(kernel.ParseJsonModule)),
+		modules:     kernel.NewModuleTable(),
+		globals:     make(map[string]Exp),
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+		stdin:       os.Stdin,
+		contracts:   true,
+	}
+}
+
+// WithContext gives a runtime sharing modules and globals with r, evaluations of which are canceled with goCtx
+func (r *Runtime) WithContext(goCtx gocontext.Context) *Runtime {
+	r2 := *r
+	r2.goCtx = goCtx
+	return &r2
+}
+
+// WithLimits gives a runtime sharing modules and globals with r, each evaluation of which is limited by limits
+func (r *Runtime) WithLimits(limits engine.Limits) *Runtime {
+	r2 := *r
+	r2.limits = &limits
+	r2.meter = nil
+	return &r2
+}
+
+// Usage gives the usage of the last limited evaluation
+func (r *Runtime) Usage() engine.Usage {
+	if r.meter == nil {
+		return engine.Usage{}
+	}
+	return r.meter.Usage()
+}
+
+func (r *Runtime) newContext(level kernel.EvalLevel) engine.Context {
+	ctx := engine.NewContext(map[string]interface{}{
+		kernel.EvalLevelKey:    level,
+		kernel.ModuleLoaderKey: r.loader,
+		kernel.ModuleTableKey:  r.modules,
+		kernel.ContractsKey:    r.contracts,
+		kernel.StdoutKey:       r.stdout,
+		kernel.StderrKey:       r.stderr,
+		kernel.StdinKey:        r.stdin,
+	})
+	if r.sandbox != nil {
+		ctx.Set(kernel.SandboxKey, r.sandbox)
+	}
+	if r.goCtx != nil {
+		ctx = engine.WithGoContext(ctx, r.goCtx)
+	}
+	if r.limits != nil {
+		ctx, r.meter = engine.WithLimits(ctx, *r.limits)
+	}
+	if r.decimal != nil {
+		ctx = engine.WithDecimalContext(ctx, *r.decimal)
+	}
+	return ctx
+}
+
+// EvalString evaluates a json expression at top level
+func (r *Runtime) EvalString(src string) (Exp, error) {
+	return r.EvalReader(strings.NewReader(src))
+}
+
+// EvalReader evaluates a json expression read from rd at top level
+func (r *Runtime) EvalReader(rd io.Reader) (Exp, error) {
+	exp, err := r.parser.Parse(engine.NewContext(nil), rd)
+	if err != nil {
+		return nil, err
+	}
+	return kernel.EvalTopLevel(r.newContext(kernel.TopLevel), r.interpreter, exp, r.globals)
+}
+
+// LoadModule loads a module by name, it is loaded only once
+func (r *Runtime) LoadModule(name string) (*kernel.Module, error) {
+	return kernel.LoadModule(r.newContext(kernel.TopLevel), r.interpreter, name)
+}
+
+// Call applies an exported function of a module, args are converted by engine.FromGo
+func (r *Runtime) Call(module, export string, args ...interface{}) (Exp, error) {
+	m, err := r.LoadModule(module)
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := m.ExportValues[export]
+	if !ok {
+		return nil, fmt.Errorf("no such name in module %q: %s", m.Name, export)
+	}
+
+	vals := make([]Exp, len(args))
+	for i, arg := range args {
+		val, err := engine.FromGo(arg)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return kernel.Apply(r.newContext(kernel.ExprLevel), r.interpreter, fn, vals...)
+}
+
+// Global gives a top level definition
+func (r *Runtime) Global(name string) (Exp, bool) {
+	val, ok := r.globals[name]
+	return val, ok
+}
+
+// SetGlobal defines name at top level, val is converted by engine.FromGo
+func (r *Runtime) SetGlobal(name string, val interface{}) error {
+	v, err := engine.FromGo(val)
+	if err != nil {
+		return err
+	}
+	r.globals[name] = v
+	return nil
+}
+
+// RegisterModule makes a module implemented in go importable in this runtime.
+// go functions are bound by kernel.BindGoFunc, other values are converted by engine.FromGo.
+func (r *Runtime) RegisterModule(name string, values map[string]interface{}) error {
+	exports := make(map[string]Exp, len(values))
+	for export, v := range values {
+		var (
+			val Exp
+			err error
+		)
+		if reflect.TypeOf(v) != nil && reflect.TypeOf(v).Kind() == reflect.Func {
+			val, err = kernel.BindGoFunc(export, v)
+		} else {
+			val, err = engine.FromGo(v)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot register module %s: %s", name, err.Error())
+		}
+		exports[export] = val
+	}
+
+	r.modules[name] = kernel.NewBuiltinModule(name, exports, nil)
+	return nil
+}
+
+func (r *Runtime) AddPaths(paths []string) {
+	r.loader.SetFindPaths(append(paths, r.loader.FindPaths()...))
+}
+
+func (r *Runtime) SetStdout(w io.Writer) {
+	r.stdout = w
+}
+
+func (r *Runtime) SetStderr(w io.Writer) {
+	r.stderr = w
+}
+
+func (r *Runtime) SetStdin(rd io.Reader) {
+	r.stdin = rd
+}
+
+// turn off contracts checking for speed
+func (r *Runtime) SetContracts(enabled bool) {
+	r.contracts = enabled
+}
+
+// SetDecimalContext sets the precision and rounding of decimal division
+func (r *Runtime) SetDecimalContext(dc engine.DecimalContext) error {
+	if dc.Precision < 0 || dc.Precision > engine.MaxDecimalScale {
+		return fmt.Errorf("invalid decimal precision: %d, at most %d", dc.Precision, engine.MaxDecimalScale)
+	}
+	r.decimal = &dc
+	return nil
+}
+
+// SetSandbox restricts modules and capabilities of evaluations, nil is unrestricted
+func (r *Runtime) SetSandbox(sandbox *kernel.Sandbox) {
+	r.sandbox = sandbox
+}
@@ -0,0 +1,262 @@
+package jsonp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crcc/jsonp/engine"
+	"github.com/crcc/jsonp/kernel"
+)
+
+func TestRuntime(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	r := NewRuntime([]string{filepath.Join(dir, "kernel", "test")})
+	var out bytes.Buffer
+	r.SetStdout(&out)
+
+	val, err := r.Call("fact", "factRec", 5)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "120" {
+		t.Fatalf("expect 120, but found %s", val.String())
+	}
+
+	// globals persist between evaluations
+	if _, err := r.EvalString(`{"def": {"double": {"func": [["x"], ["*", "x", 2]]}}}`); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := r.SetGlobal("n", 21); err != nil {
+		t.Fatal(err.Error())
+	}
+	val, err = r.EvalReader(strings.NewReader(`["double", "n"]`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "42" {
+		t.Fatalf("expect 42, but found %s", val.String())
+	}
+	if _, ok := r.Global("double"); !ok {
+		t.Fatal("expect global double")
+	}
+
+	// go modules
+	err = r.RegisterModule("greet", map[string]interface{}{
+		"hello": func(name string) string { return "hello, " + name },
+		"names": []string{"a", "b"},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = r.EvalString(`{"begin": [{"import": {"greet": ["hello", "names"], "io": ["print"]}}, ["print", ["hello", {"data": "jsonp"}]]]}`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if out.String() != "\"hello, jsonp\"\n" {
+		t.Fatalf("expect printed greeting, but found %q", out.String())
+	}
+	val, err = r.Call("greet", "hello", "go")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != `"hello, go"` {
+		t.Fatalf("expect hello, go, but found %s", val.String())
+	}
+
+	// modules are loaded once
+	m1, err := r.LoadModule("fact")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	m2, _ := r.LoadModule("fact")
+	if m1 != m2 {
+		t.Fatal("expect module loaded once")
+	}
+
+	if _, err := r.Call("fact", "missing"); err == nil {
+		t.Fatal("expect missing export error")
+	}
+	if _, err := r.EvalString(`["undefined-name"]`); err == nil {
+		t.Fatal("expect unbound name error")
+	}
+}
+
+func TestRuntime_IsolatedPrelude(t *testing.T) {
+	r1 := NewRuntime(nil)
+	if _, err := r1.EvalString(`{"set": {"+": 5}}`); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	r2 := NewRuntime(nil)
+	val, err := r2.EvalString(`["+", 1, 2]`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "3" {
+		t.Fatalf("expect 3, but found %s", val.String())
+	}
+}
+
+func TestRuntime_DecimalContext(t *testing.T) {
+	r := NewRuntime(nil)
+	if err := r.SetDecimalContext(engine.DecimalContext{Precision: 2, Rounding: engine.RoundUp}); err != nil {
+		t.Fatal(err.Error())
+	}
+	val, err := r.EvalString(`["/", {"decimal": "2"}, 3]`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "0.67" {
+		t.Fatalf("expect 0.67, but found %s", val.String())
+	}
+
+	// other runtimes keep the default
+	val, err = NewRuntime(nil).EvalString(`["/", {"decimal": "2"}, 3]`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "0.6666666666666667" {
+		t.Fatalf("expect 0.6666666666666667, but found %s", val.String())
+	}
+
+	if err := r.SetDecimalContext(engine.DecimalContext{Precision: 1 << 30}); err == nil {
+		t.Fatal("expect invalid decimal precision")
+	}
+}
+
+func TestRuntime_WithContext(t *testing.T) {
+	r := NewRuntime(nil)
+	if _, err := r.EvalString(`{"def": {"loop": {"func": [["n"], ["loop", ["+", "n", 1]]]}}}`); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	goCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := r.WithContext(goCtx).EvalString(`["loop", 0]`)
+	if !engine.IsCanceled(err) {
+		t.Fatalf("expect canceled, but found %v", err)
+	}
+
+	// r is not canceled
+	val, err := r.EvalString(`["+", 1, 2]`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "3" {
+		t.Fatalf("expect 3, but found %s", val.String())
+	}
+}
+
+func TestRuntime_WithLimits(t *testing.T) {
+	r := NewRuntime(nil)
+	if _, err := r.EvalString(`{"def": {
+		"loop": {"func": [["n"], ["loop", ["+", "n", 1]]]},
+		"sum": {"func": [["n"], {"if": [["<=", "n", 0], 0, ["+", "n", ["sum", ["-", "n", 1]]]]}]}
+	}}`); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	limited := r.WithLimits(engine.Limits{MaxSteps: 1000})
+	_, err := limited.EvalString(`["loop", 0]`)
+	var limitErr *engine.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "steps" {
+		t.Fatalf("expect steps limit error, but found %v", err)
+	}
+	if limited.Usage().Steps != 1001 {
+		t.Fatalf("expect 1001 steps, but found %s", limited.Usage().String())
+	}
+
+	val, err := limited.EvalString(`["sum", 10]`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val.String() != "55" {
+		t.Fatalf("expect 55, but found %s", val.String())
+	}
+	usage := limited.Usage()
+	if usage.Steps == 0 || usage.MaxDepth == 0 {
+		t.Fatalf("expect usage counted, but found %s", usage.String())
+	}
+
+	// evaluation is deterministic
+	if _, err := limited.EvalString(`["sum", 10]`); err != nil || limited.Usage() != usage {
+		t.Fatalf("expect same usage %s, but found %s", usage.String(), limited.Usage().String())
+	}
+
+	_, err = r.WithLimits(engine.Limits{MaxDepth: 50}).EvalString(`["sum", 100]`)
+	if !errors.As(err, &limitErr) || limitErr.Limit != "depth" {
+		t.Fatalf("expect depth limit error, but found %v", err)
+	}
+
+	for src, limits := range map[string]engine.Limits{
+		`{"begin": [{"import": {"string": ["repeat"]}}, ["repeat", {"data": "ab"}, 10]]}`: {MaxStringLength: 10},
+		`{"begin": [{"import": {"list": ["range"]}}, ["range", 0, 100]]}`:                 {MaxListLength: 10},
+		`{"begin": [{"import": {"list": ["range"]}}, ["range", 0, 5], ["range", 0, 5]]}`:  {MaxAlloc: 8},
+		// refused before the result is built
+		`{"begin": [{"import": {"list": ["range"]}}, ["range", 0, 50000000]]}`:                                     {MaxAlloc: 1000},
+		`{"begin": [{"import": {"string": ["pad-left"]}}, ["pad-left", {"data": "x"}, 50000000, {"data": "ab"}]]}`: {MaxStringLength: 10},
+		`["decimal-format", 1, 10000]`: {MaxStringLength: 10},
+		`{"begin": [{"import": {"math": ["pow"]}}, ["pow", ["pow", 10, 1048576], 1048576]]}`:                                                    {MaxAlloc: 2000000},
+		`{"begin": [{"def": {"sq": {"func": [["x"], ["sq", ["*", "x", "x"]]]}}}, ["sq", 3]]}`:                                                   {MaxAlloc: 1000000},
+		`{"begin": [{"import": {"string": ["format"]}}, ["format", {"data": "%1000000d"}, {"data": [1]}]]}`:                                     {MaxStringLength: 1000},
+		`{"begin": [{"import": {"string": ["format"]}}, ["format", {"data": "{a}{a}{a}{a}"}, {"data": {"a": "abc"}}]]}`:                         {MaxStringLength: 10},
+		`{"begin": [{"import": {"string": ["replace", "repeat"]}}, ["replace", ["repeat", {"data": "a"}, 100], {"data": ""}, {"data": "bb"}]]}`: {MaxStringLength: 200},
+	} {
+		if _, err := r.WithLimits(limits).EvalString(src); !engine.IsLimitExceeded(err) {
+			t.Fatalf("%s: expect limit error, but found %v", src, err)
+		}
+	}
+	if _, err := r.WithLimits(engine.Limits{MaxListLength: 10}).EvalString(`{"begin": [{"import": {"list": ["range"]}}, ["range", 0, 10]]}`); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// reserved results are counted once
+	var allocs []int64
+	for _, src := range []string{`["repeat", {"data": "ab"}, 5]`, `["repeat", {"data": "ab"}, 6]`} {
+		limited := r.WithLimits(engine.Limits{MaxAlloc: 1000})
+		if _, err := limited.EvalString(`{"begin": [{"import": {"string": ["repeat"]}}, ` + src + `]}`); err != nil {
+			t.Fatal(err.Error())
+		}
+		allocs = append(allocs, limited.Usage().Alloc)
+	}
+	if allocs[1]-allocs[0] != 2 {
+		t.Fatalf("expect 2 more runes counted, but found %d", allocs[1]-allocs[0])
+	}
+}
+
+func TestRuntime_Sandbox(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	r := NewRuntime([]string{filepath.Join(dir, "kernel", "test")})
+	r.SetSandbox(kernel.NewSandbox([]string{"fact"}, []string{}))
+
+	if _, err := r.Call("fact", "factRec", 3); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := r.Call("fact2", "fact", 3); err == nil || !strings.Contains(err.Error(), `sandbox denied module "fact2"`) {
+		t.Fatalf("expect fact2 denied, but found %v", err)
+	}
+
+	// fact2 imports fact, which is not allowed transitively
+	r = NewRuntime([]string{filepath.Join(dir, "kernel", "test")})
+	r.SetSandbox(kernel.NewSandbox([]string{"fact2"}, []string{}))
+	if _, err := r.Call("fact2", "fact", 3); err == nil || !strings.Contains(err.Error(), `sandbox denied module "fact"`) {
+		t.Fatalf("expect fact denied, but found %v", err)
+	}
+	r = NewRuntime([]string{filepath.Join(dir, "kernel", "test")})
+	r.SetSandbox(kernel.NewSandbox([]string{"fact", "fact2"}, []string{}))
+	if _, err := r.Call("fact2", "fact", 3); err != nil {
+		t.Fatal(err.Error())
+	}
+}